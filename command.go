@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/handler"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const commandUsage = `usage:
+  hmblog [-c config] admin create-user -username NAME [-role ROLE] [-password PASSWORD]
+  hmblog [-c config] admin reset-password -username NAME [-password PASSWORD]
+
+a random password is created and printed if -password isn't given,
+the user must change the password on first login`
+
+// runCommand runs the admin command given in commandline args
+func runCommand(args []string) error {
+	if len(args) < 2 || args[0] != "admin" {
+		return errors.New(commandUsage)
+	}
+
+	switch args[1] {
+	case "create-user":
+		return createUser(args[2:])
+	case "reset-password":
+		return resetPassword(args[2:])
+	}
+
+	return errors.New(commandUsage)
+}
+
+// createUser creates a blog user
+func createUser(args []string) error {
+	flags := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	username := flags.String("username", "", "the username")
+	role := flags.String("role", structure.RoleOwner, "the role of user")
+	password := flags.String("password", "", "the password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return errors.New("username required")
+	}
+
+	if !structure.IsValidRole(*role) {
+		return fmt.Errorf("invalid role %q", *role)
+	}
+
+	users, err := database.Users(bson.M{
+		"username": *username,
+	})
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("user %q already exists", *username)
+	}
+
+	psw, err := newPassword(*username, *password)
+	if err != nil {
+		return err
+	}
+
+	pswHash, err := handler.HashPassword(psw)
+	if err != nil {
+		return err
+	}
+
+	mustChangePassword := true
+	err = database.InsertUser(&structure.User{
+		Username:           *username,
+		PasswordHash:       pswHash,
+		Role:               *role,
+		Disabled:           new(bool),
+		MustChangePassword: &mustChangePassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created user %q with role %q\n", *username, *role)
+	if *password == "" {
+		fmt.Println("password: " + psw)
+	}
+
+	return nil
+}
+
+// resetPassword resets the password of a blog user,
+// signs out all sessions and clears the login lockout
+func resetPassword(args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := flags.String("username", "", "the username")
+	password := flags.String("password", "", "the new password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	user, err := database.User(bson.M{
+		"username": strings.TrimSpace(*username),
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			return fmt.Errorf("no user named %q", *username)
+		}
+		return err
+	}
+
+	psw, err := newPassword(user.Username, *password)
+	if err != nil {
+		return err
+	}
+
+	pswHash, err := handler.HashPassword(psw)
+	if err != nil {
+		return err
+	}
+
+	mustChangePassword := true
+	err = database.UpdateUser(
+		bson.M{
+			"_id": user.ID,
+		},
+		structure.User{
+			PasswordHash:       pswHash,
+			MustChangePassword: &mustChangePassword,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = handler.RevokeUserTokens(*user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = database.RemoveLoginFailures(bson.M{
+		"kind":  structure.LoginFailureUsername,
+		"value": user.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("reset the password of user %q\n", user.Username)
+	if *password == "" {
+		fmt.Println("password: " + psw)
+	}
+
+	return nil
+}
+
+// newPassword returns the given password if it satisfies
+// the password policy, or a random one if it isn't given
+func newPassword(username string, password string) (string, error) {
+	if password != "" {
+		return password, handler.CheckPassword(username, password)
+	}
+
+	return database.RandomPassword()
+}
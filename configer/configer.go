@@ -6,15 +6,76 @@ import (
 	"os"
 )
 
+// JWTKey the configuration of a key used to sign or verify jwt token
+type JWTKey struct {
+	KID            string `json:"kid"`
+	Algorithm      string `json:"algorithm"`
+	Secret         string `json:"secret"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKeyFile  string `json:"public_key_file"`
+	VerifyUntil    string `json:"verify_until"`
+}
+
+// SMTP the configuration of smtp server used to send mails
+type SMTP struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// OIDC the configuration of OpenID Connect login, it's
+// enabled if the issuer is given, users are created on first
+// login with the default role if AutoCreate is set, owners
+// are linked by email only if LinkOwnerByEmail is set
+type OIDC struct {
+	Issuer           string   `json:"issuer"`
+	ClientID         string   `json:"client_id"`
+	ClientSecret     string   `json:"client_secret"`
+	RedirectURL      string   `json:"redirect_url"`
+	Scopes           []string `json:"scopes"`
+	LinkByEmail      bool     `json:"link_by_email"`
+	LinkOwnerByEmail bool     `json:"link_owner_by_email"`
+	AutoCreate       bool     `json:"auto_create"`
+	DefaultRole      string   `json:"default_role"`
+}
+
 // Configer the configuration struct
 type Configer struct {
-	MongoDBHost    string `json:"mongodb_host"`
-	MongoDBListen  int    `json:"mongodb_listen"`
-	DBUser         string `json:"db_user"`
-	DBUserPassword string `json:"db_user_password"`
-	DBName         string `json:"database_name"`
-	Listen         int    `json:"listen"`
-	LogFile        string `json:"log_file"`
+	MongoDBHost    string   `json:"mongodb_host"`
+	MongoDBListen  int      `json:"mongodb_listen"`
+	DBUser         string   `json:"db_user"`
+	DBUserPassword string   `json:"db_user_password"`
+	DBName         string   `json:"database_name"`
+	Listen         int      `json:"listen"`
+	LogFile        string   `json:"log_file"`
+	AdminPassword  string   `json:"admin_password"`
+	JWTSigningKID  string   `json:"jwt_signing_kid"`
+	JWTKeys        []JWTKey `json:"jwt_keys"`
+
+	// password policy, the checks are enabled if not given
+	PasswordMinLength     int   `json:"password_min_length"`
+	PasswordCheckCommon   *bool `json:"password_check_common"`
+	PasswordCheckUsername *bool `json:"password_check_username"`
+	BcryptCost            int   `json:"bcrypt_cost"`
+
+	// the link in password reset mail is the url
+	// with the reset token as query parameter "token"
+	SMTP             SMTP   `json:"smtp"`
+	PasswordResetURL string `json:"password_reset_url"`
+
+	OIDC OIDC `json:"oidc"`
+
+	// post revision retention, a revision is kept if it's one of
+	// the latest RevisionKeep revisions (50 if not given) or made
+	// in the last RevisionDays days
+	RevisionKeep int `json:"revision_keep"`
+	RevisionDays int `json:"revision_days"`
+
+	// deleted posts and categories are purged from trash after
+	// TrashRetentionDays days (30 if not given), never if negative
+	TrashRetentionDays int `json:"trash_retention_days"`
 }
 
 // Config the global config
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// AuditEntries returns the latest audit log entries which match
+// the filter, no more than limit entries are returned
+func AuditEntries(filter bson.M, limit int) ([]structure.AuditEntry, error) {
+	var entries []structure.AuditEntry
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("audit_log")
+
+	err := c.Find(filter).Sort("-created_at").Limit(limit).All(&entries)
+
+	return entries, err
+}
+
+// InsertAuditEntry inserts an audit log entry,
+// the audit log is append-only
+func InsertAuditEntry(entry *structure.AuditEntry) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("audit_log")
+
+	if entry.ID == nil {
+		entry.ID = new(bson.ObjectId)
+	}
+	*entry.ID = bson.NewObjectId()
+
+	return c.Insert(entry)
+}
@@ -23,12 +23,13 @@ func Categories(filter bson.M) ([]structure.Category, error) {
 
 	pipeline := []bson.M{
 		bson.M{
-			"$match": filter,
+			"$match": notDeleted(filter),
 		},
 		bson.M{
 			"$project": bson.M{
 				"_id":  1,
 				"name": 1,
+				"slug": 1,
 			},
 		},
 	}
@@ -38,6 +39,35 @@ func Categories(filter bson.M) ([]structure.Category, error) {
 	return categories, err
 }
 
+// CategoryCount returns the amount of categories that matches the filter
+func CategoryCount(filter bson.M) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("categories")
+
+	return c.Find(notDeleted(filter)).Count()
+}
+
+// CategoriesPage returns a page of categories which match the filter,
+// sorted by the fields, skip and limit are ignored if zero
+func CategoriesPage(filter bson.M, sort []string, skip int, limit int) ([]structure.Category, error) {
+	var categories []structure.Category
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("categories")
+
+	err := c.Find(notDeleted(filter)).Select(bson.M{
+		"_id":  1,
+		"name": 1,
+		"slug": 1,
+	}).Sort(sort...).Skip(skip).Limit(limit).All(&categories)
+
+	return categories, err
+}
+
 // InsertCategory inserts a category
 func InsertCategory(category *structure.Category) error {
 	session := mgoSession.Copy()
@@ -64,7 +94,7 @@ func UpdateCategory(filter bson.M, category structure.Category) error {
 	c := session.DB(dbName).C("categories")
 
 	err := c.Update(
-		filter,
+		notDeleted(filter),
 		bson.M{
 			"$set": category,
 		},
@@ -75,14 +105,3 @@ func UpdateCategory(filter bson.M, category structure.Category) error {
 
 	return err
 }
-
-// RemoveCategories removes all categories that matches the filter
-func RemoveCategories(filter bson.M) error {
-	session := mgoSession.Copy()
-	defer session.Close()
-
-	c := session.DB(dbName).C("categories")
-
-	_, err := c.RemoveAll(filter)
-	return err
-}
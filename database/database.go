@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/globalsign/mgo"
 
@@ -32,7 +33,88 @@ func Initialize() error {
 		return err
 	}
 
-	return initBlogUser()
+	// renaming and merging tags update the posts with
+	// aggregation pipeline, which requires MongoDB 4.2
+	info, err := mgoSession.BuildInfo()
+	if err != nil {
+		return err
+	}
+	if !info.VersionAtLeast(4, 2) {
+		return fmt.Errorf("MongoDB %s isn't supported, 4.2 or above is required", info.Version)
+	}
+
+	err = migrateUsers()
+	if err != nil {
+		return err
+	}
+
+	return initIndexes()
+}
+
+// initIndexes ensures the indexes used by queries
+// and the TTL indexes that clean up expired documents
+func initIndexes() error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	db := session.DB(dbName)
+
+	// expireAfter removes a document once its "expires_at" passes
+	expireAfter := mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	}
+
+	indexes := []struct {
+		collection string
+		index      mgo.Index
+	}{
+		{"users", mgo.Index{Key: []string{"email"}, Unique: true, Sparse: true}},
+		{"users", mgo.Index{Key: []string{"oidc_issuer", "oidc_subject"}, Unique: true, Sparse: true}},
+		{"refresh_tokens", mgo.Index{Key: []string{"token_hash"}, Unique: true}},
+		{"refresh_tokens", expireAfter},
+		{"revoked_tokens", mgo.Index{Key: []string{"jti"}}},
+		{"revoked_tokens", expireAfter},
+		{"invitations", mgo.Index{Key: []string{"token_hash"}, Unique: true}},
+		{"invitations", expireAfter},
+		{"login_challenges", mgo.Index{Key: []string{"token_hash"}, Unique: true}},
+		{"login_challenges", expireAfter},
+		{"login_failures", mgo.Index{Key: []string{"kind", "value"}, Unique: true}},
+		{"login_failures", expireAfter},
+		{"access_tokens", mgo.Index{Key: []string{"token_hash"}, Unique: true}},
+		{"access_tokens", expireAfter},
+		{"password_resets", mgo.Index{Key: []string{"token_hash"}, Unique: true}},
+		{"password_resets", expireAfter},
+		{"oidc_states", mgo.Index{Key: []string{"state_hash"}, Unique: true}},
+		{"oidc_states", expireAfter},
+		{"sessions", mgo.Index{Key: []string{"user_id"}}},
+		{"sessions", expireAfter},
+		{"audit_log", mgo.Index{Key: []string{"-created_at"}}},
+		{"audit_log", mgo.Index{Key: []string{"actor_id", "-created_at"}}},
+		{"audit_log", mgo.Index{Key: []string{"target_id", "-created_at"}}},
+		{"posts", mgo.Index{Key: []string{"is_publish", "-created_at", "-_id"}}},
+		{"posts", mgo.Index{Key: []string{"is_publish", "-updated_at", "-_id"}}},
+		{"posts", mgo.Index{Key: []string{"tags"}}},
+		{"posts", mgo.Index{Key: []string{"user_id"}}},
+		{"posts", mgo.Index{Key: []string{"category_id"}}},
+		{"posts", mgo.Index{Key: []string{"slug"}, Unique: true, Sparse: true}},
+		{"posts", mgo.Index{Key: []string{"is_publish", "publish_at"}}},
+		{"posts", mgo.Index{Key: []string{"deleted_at"}, Sparse: true}},
+		{"categories", mgo.Index{Key: []string{"slug"}, Unique: true, Sparse: true}},
+		{"categories", mgo.Index{Key: []string{"deleted_at"}, Sparse: true}},
+		{"slug_history", mgo.Index{Key: []string{"collection", "slug"}, Unique: true}},
+		{"slug_history", mgo.Index{Key: []string{"target_id"}}},
+		{"post_revisions", mgo.Index{Key: []string{"post_id", "-number"}, Unique: true}},
+	}
+
+	for _, i := range indexes {
+		err := db.C(i.collection).EnsureIndex(i.index)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // CloseSession closes the original mgo session "mgoSession"
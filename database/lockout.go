@@ -0,0 +1,69 @@
+package database
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// LoginFailures returns all login failure counters which match the filter
+func LoginFailures(filter bson.M) ([]structure.LoginFailure, error) {
+	var failures []structure.LoginFailure
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_failures")
+
+	err := c.Find(filter).All(&failures)
+
+	return failures, err
+}
+
+// IncLoginFailure increases the login failure counter of the kind
+// and value, the counter is created if it doesn't exist, and it
+// will be removed once expiresAt passes
+func IncLoginFailure(kind string, value string, expiresAt time.Time) (structure.LoginFailure, error) {
+	var failure structure.LoginFailure
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_failures")
+
+	_, err := c.Find(bson.M{
+		"kind":  kind,
+		"value": value,
+	}).Apply(
+		mgo.Change{
+			Update: bson.M{
+				"$inc": bson.M{
+					"failures": 1,
+				},
+				"$set": bson.M{
+					"last_failure": time.Now(),
+					"expires_at":   expiresAt,
+				},
+			},
+			Upsert:    true,
+			ReturnNew: true,
+		},
+		&failure,
+	)
+
+	return failure, err
+}
+
+// RemoveLoginFailures removes all login failure counters that matches the filter
+func RemoveLoginFailures(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_failures")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
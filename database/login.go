@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// ErrNoLoginChallenge returned when no login challenge found
+var ErrNoLoginChallenge = errors.New("no such login challenge")
+
+// LoginChallenge returns one login challenge that matches the filter
+func LoginChallenge(filter bson.M) (structure.LoginChallenge, error) {
+	var challenge structure.LoginChallenge
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_challenges")
+
+	err := c.Find(filter).One(&challenge)
+	if err != nil && err == mgo.ErrNotFound {
+		return challenge, ErrNoLoginChallenge
+	}
+
+	return challenge, err
+}
+
+// InsertLoginChallenge inserts a login challenge
+func InsertLoginChallenge(challenge *structure.LoginChallenge) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_challenges")
+
+	if challenge.ID == nil {
+		challenge.ID = new(bson.ObjectId)
+	}
+	*challenge.ID = bson.NewObjectId()
+
+	return c.Insert(challenge)
+}
+
+// AttemptLoginChallenge counts an attempt of a login challenge which
+// has been attempted less than limit times, ErrNoLoginChallenge
+// returned when the challenge doesn't exist or reaches the limit
+func AttemptLoginChallenge(id bson.ObjectId, limit int) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("login_challenges")
+
+	// checked and increased in one update, so parallel
+	// attempts can't exceed the limit
+	err := c.Update(
+		bson.M{
+			"_id": id,
+			"attempts": bson.M{
+				"$lt": limit,
+			},
+		},
+		bson.M{
+			"$inc": bson.M{
+				"attempts": 1,
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoLoginChallenge
+	}
+
+	return err
+}
+
+// UseLoginChallenge removes the login challenge that matches the filter
+// and returns it, so a challenge can only be used once,
+// ErrNoLoginChallenge returned when it doesn't exist
+func UseLoginChallenge(filter bson.M) (structure.LoginChallenge, error) {
+	var challenge structure.LoginChallenge
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_challenges")
+
+	_, err := c.Find(filter).Apply(mgo.Change{Remove: true}, &challenge)
+	if err != nil && err == mgo.ErrNotFound {
+		return challenge, ErrNoLoginChallenge
+	}
+
+	return challenge, err
+}
+
+// RemoveLoginChallenges removes all login challenges that matches the filter
+func RemoveLoginChallenges(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("login_challenges")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
+
+// ErrNoOIDCState returned when no OpenID Connect login state found
+var ErrNoOIDCState = errors.New("no such oidc state")
+
+// InsertOIDCState inserts an OpenID Connect login state
+func InsertOIDCState(state *structure.OIDCState) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("oidc_states")
+
+	if state.ID == nil {
+		state.ID = new(bson.ObjectId)
+	}
+	*state.ID = bson.NewObjectId()
+
+	return c.Insert(state)
+}
+
+// UseOIDCState removes the OpenID Connect login state that matches
+// the filter and returns it, so a state can only be used once,
+// ErrNoOIDCState returned when it doesn't exist
+func UseOIDCState(filter bson.M) (structure.OIDCState, error) {
+	var state structure.OIDCState
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("oidc_states")
+
+	_, err := c.Find(filter).Apply(mgo.Change{Remove: true}, &state)
+	if err != nil && err == mgo.ErrNotFound {
+		return state, ErrNoOIDCState
+	}
+
+	return state, err
+}
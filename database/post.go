@@ -2,12 +2,73 @@ package database
 
 import (
 	"errors"
+	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
+	"github.com/jaaaaason/hmblog/render"
+	"github.com/jaaaaason/hmblog/search"
 	"github.com/jaaaaason/hmblog/structure"
 )
 
+// searchDocument returns the searchable fields of the post
+func searchDocument(post structure.Post) search.Document {
+	doc := search.Document{
+		ID:      post.ID.Hex(),
+		Title:   post.Title,
+		Content: post.Content,
+		Tags:    post.Tags,
+	}
+	// the markup isn't searchable and isn't shown in snippets
+	if content, err := render.Text(post.Format, post.Content); err == nil {
+		doc.Content = content
+	}
+	if post.IsPublish != nil {
+		doc.IsPublish = *post.IsPublish
+	}
+	if post.UserID != nil {
+		doc.UserID = post.UserID.Hex()
+	}
+
+	return doc
+}
+
+// indexPosts adds the posts that matches the filter to search index,
+// the posts in trash aren't searchable
+func indexPosts(c *mgo.Collection, filter bson.M) error {
+	var post structure.Post
+	iter := c.Find(notDeleted(filter)).Iter()
+	for iter.Next(&post) {
+		search.Index(searchDocument(post))
+		post = structure.Post{}
+	}
+
+	return iter.Close()
+}
+
+// IndexPosts builds the search index from all posts in database
+func IndexPosts() error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	return indexPosts(c, nil)
+}
+
+// postIDs returns the ids of posts that matches the filter
+func postIDs(c *mgo.Collection, filter bson.M) ([]bson.ObjectId, error) {
+	var posts []structure.Post
+	err := c.Find(filter).Select(bson.M{"_id": 1}).All(&posts)
+
+	ids := make([]bson.ObjectId, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, *post.ID)
+	}
+
+	return ids, err
+}
+
 // PostCount returns the amount of post that matches the filter
 func PostCount(filter bson.M) (int, error) {
 	session := mgoSession.Copy()
@@ -15,7 +76,7 @@ func PostCount(filter bson.M) (int, error) {
 
 	c := session.DB(dbName).C("posts")
 
-	return c.Find(filter).Count()
+	return c.Find(notDeleted(filter)).Count()
 }
 
 // Posts retrieves posts that matches the filter from database
@@ -26,7 +87,21 @@ func Posts(filter bson.M) ([]structure.Post, error) {
 	c := session.DB(dbName).C("posts")
 
 	var posts []structure.Post
-	err := c.Find(filter).All(&posts)
+	err := c.Find(notDeleted(filter)).All(&posts)
+
+	return posts, err
+}
+
+// PostsPage retrieves a page of posts that matches the filter,
+// sorted by the fields, skip and limit are ignored if zero
+func PostsPage(filter bson.M, sort []string, skip int, limit int) ([]structure.Post, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	var posts []structure.Post
+	err := c.Find(notDeleted(filter)).Sort(sort...).Skip(skip).Limit(limit).All(&posts)
 
 	return posts, err
 }
@@ -43,7 +118,13 @@ func InsertPost(post *structure.Post) error {
 	}
 	*post.ID = bson.NewObjectId()
 
-	return c.Insert(post)
+	err := c.Insert(post)
+	if err != nil {
+		return err
+	}
+
+	search.Index(searchDocument(*post))
+	return nil
 }
 
 // ErrNoPost returned when no category found
@@ -55,30 +136,151 @@ func UpdatePost(filter bson.M, post structure.Post) error {
 	session := mgoSession.Copy()
 	defer session.Close()
 
-	// set safe mode to return ErrNotFound if a document isn't found
-	session.SetSafe(&mgo.Safe{})
 	c := session.DB(dbName).C("posts")
 
-	err := c.Update(
-		filter,
-		bson.M{
+	// return the updated post to refresh search index
+	var updated structure.Post
+	_, err := c.Find(notDeleted(filter)).Apply(mgo.Change{
+		Update: bson.M{
 			"$set": post,
 		},
+		ReturnNew: true,
+	}, &updated)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrNoPost
+		}
+		return err
+	}
+
+	render.Invalidate(updated.ID.Hex())
+	search.Index(searchDocument(updated))
+	return nil
+}
+
+// UnsetPostFields removes the fields from a post, so the
+// derived values of the fields are used again
+func UnsetPostFields(id bson.ObjectId, fields ...string) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	unset := bson.M{}
+	for _, field := range fields {
+		unset[field] = ""
+	}
+
+	var updated structure.Post
+	_, err := c.Find(notDeleted(bson.M{
+		"_id": id,
+	})).Apply(mgo.Change{
+		Update: bson.M{
+			"$unset": unset,
+		},
+		ReturnNew: true,
+	}, &updated)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrNoPost
+		}
+		return err
+	}
+
+	render.Invalidate(updated.ID.Hex())
+	search.Index(searchDocument(updated))
+	return nil
+}
+
+// UnschedulePost cancels the scheduled publishing of a post
+func UnschedulePost(id bson.ObjectId) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	return c.UpdateId(id, bson.M{
+		"$unset": bson.M{
+			"publish_at": "",
+		},
+	})
+}
+
+// PublishDuePosts publishes the scheduled posts whose publishing time
+// has come, returns the amount of published posts
+func PublishDuePosts(now time.Time) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	due := notDeleted(bson.M{
+		"is_publish": false,
+		"publish_at": bson.M{
+			"$lte": now,
+		},
+	})
+
+	ids, err := postIDs(c, due)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// the filter is applied again in case a post is rescheduled
+	due["_id"] = bson.M{
+		"$in": ids,
+	}
+	info, err := c.UpdateAll(
+		due,
+		bson.M{
+			"$set": bson.M{
+				"is_publish": true,
+			},
+			"$unset": bson.M{
+				"publish_at": "",
+			},
+		},
 	)
-	if err != nil && err == mgo.ErrNotFound {
-		return ErrNoPost
+	if err != nil {
+		return 0, err
 	}
 
-	return err
+	// the publish state is indexed to search published posts
+	return info.Updated, indexPosts(c, bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
 }
 
-// RemovePosts removes all posts that matches the filter
-func RemovePosts(filter bson.M) error {
+// ReassignPosts changes the owner of all posts that matches the filter
+func ReassignPosts(filter bson.M, userID bson.ObjectId) error {
 	session := mgoSession.Copy()
 	defer session.Close()
 
 	c := session.DB(dbName).C("posts")
 
-	_, err := c.RemoveAll(filter)
-	return err
+	ids, err := postIDs(c, filter)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.UpdateAll(
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"user_id": userID,
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// the owner is indexed to search drafts
+	return indexPosts(c, bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
 }
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// insertRevisionRetries the times a revision number is taken
+// before giving up when concurrent inserts keep taking it
+const insertRevisionRetries = 5
+
+// ErrNoPostRevision returned when no revision found
+var ErrNoPostRevision = errors.New("no such post revision")
+
+// PostRevisions retrieves the revisions of the post, the latest first
+func PostRevisions(postID bson.ObjectId) ([]structure.PostRevision, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("post_revisions")
+
+	var revisions []structure.PostRevision
+	err := c.Find(bson.M{
+		"post_id": postID,
+	}).Sort("-number").All(&revisions)
+
+	return revisions, err
+}
+
+// PostRevision retrieves a revision of the post by its number
+func PostRevision(postID bson.ObjectId, number int) (*structure.PostRevision, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("post_revisions")
+
+	revision := new(structure.PostRevision)
+	err := c.Find(bson.M{
+		"post_id": postID,
+		"number":  number,
+	}).One(revision)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNoPostRevision
+	}
+
+	return revision, err
+}
+
+// InsertPostRevision inserts a revision numbered after
+// the latest revision of the post, the number is taken again
+// if a concurrent insert has taken it
+func InsertPostRevision(revision *structure.PostRevision) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("post_revisions")
+
+	if revision.ID == nil {
+		revision.ID = new(bson.ObjectId)
+	}
+
+	var err error
+	for i := 0; i < insertRevisionRetries; i++ {
+		var latest structure.PostRevision
+		err = c.Find(bson.M{
+			"post_id": revision.PostID,
+		}).Sort("-number").One(&latest)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+
+		*revision.ID = bson.NewObjectId()
+		revision.Number = latest.Number + 1
+
+		// the unique index on post_id and number
+		// rejects a number that has been taken
+		err = c.Insert(revision)
+		if !mgo.IsDup(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// PrunePostRevisions removes the revisions of the post except the
+// latest keep revisions and the ones made after since, keep is
+// ignored if it's negative and since is ignored if it's zero
+func PrunePostRevisions(postID bson.ObjectId, keep int, since time.Time) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("post_revisions")
+
+	if keep < 0 && since.IsZero() {
+		// keep all revisions
+		return nil
+	}
+
+	filter := bson.M{
+		"post_id": postID,
+	}
+	if !since.IsZero() {
+		filter["created_at"] = bson.M{
+			"$lt": since,
+		}
+	}
+	if keep >= 0 {
+		// the oldest revision of the latest ones
+		var kept []structure.PostRevision
+		err := c.Find(bson.M{
+			"post_id": postID,
+		}).Sort("-number").Skip(keep).Limit(1).All(&kept)
+		if err != nil || len(kept) == 0 {
+			return err
+		}
+		filter["number"] = bson.M{
+			"$lte": kept[0].Number,
+		}
+	}
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// ErrNoSlugHistory returned when the slug isn't a previous slug
+var ErrNoSlugHistory = errors.New("no such slug history")
+
+// SlugHistory retrieves the previous slug of the collection
+func SlugHistory(collection string, slug string) (*structure.SlugHistory, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("slug_history")
+
+	history := new(structure.SlugHistory)
+	err := c.Find(bson.M{
+		"collection": collection,
+		"slug":       slug,
+	}).One(history)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNoSlugHistory
+	}
+
+	return history, err
+}
+
+// MoveSlug records the old slug of the target as a previous slug, and
+// removes the new slug from history in case the target uses it again,
+// the old slug is empty if the target had no slug
+func MoveSlug(collection string, targetID bson.ObjectId, oldSlug string, newSlug string) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("slug_history")
+
+	_, err := c.RemoveAll(bson.M{
+		"collection": collection,
+		"slug":       newSlug,
+	})
+	if err != nil || oldSlug == "" {
+		return err
+	}
+
+	// the slug may have been used by the target before
+	_, err = c.Upsert(
+		bson.M{
+			"collection": collection,
+			"slug":       oldSlug,
+		},
+		structure.SlugHistory{
+			Collection: collection,
+			Slug:       oldSlug,
+			TargetID:   &targetID,
+			CreatedAt:  time.Now(),
+		},
+	)
+	return err
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// Tags returns the tags of the posts that matches the filter
+// with the amount of posts, the most used tag first
+func Tags(filter bson.M) ([]structure.Tag, error) {
+	var tags []structure.Tag
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	pipeline := []bson.M{
+		bson.M{
+			"$match": notDeleted(filter),
+		},
+		bson.M{
+			"$unwind": "$tags",
+		},
+		bson.M{
+			"$group": bson.M{
+				"_id": "$tags",
+				"post_count": bson.M{
+					"$sum": 1,
+				},
+			},
+		},
+		bson.M{
+			"$sort": bson.D{
+				{Name: "post_count", Value: -1},
+				{Name: "_id", Value: 1},
+			},
+		},
+	}
+
+	err := c.Pipe(pipeline).All(&tags)
+
+	return tags, err
+}
+
+// AllTags returns the distinct tags of all posts, including
+// the posts in trash
+func AllTags() ([]string, error) {
+	var tags []string
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	err := c.Find(nil).Distinct("tags", &tags)
+
+	return tags, err
+}
+
+// ReplaceTags replaces the tags in from by the tag to in all posts,
+// including the posts in trash, the tags are removed if to is empty,
+// returns the amount of changed posts.
+//
+// The tags of each post are replaced atomically by one update command
+// on the server, so no post is left with part of its tags replaced.
+// The driver has no multi-document transactions, so the command may
+// be seen halfway by readers, and running it again completes it if
+// it fails partway. It requires MongoDB 4.2, checked by Initialize
+func ReplaceTags(from []string, to string) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	db := session.DB(dbName)
+
+	filter := bson.M{
+		"tags": bson.M{
+			"$in": from,
+		},
+	}
+
+	// the ids of changed posts to refresh search index
+	ids, err := postIDs(db.C("posts"), filter)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// an update with aggregation pipeline, which requires MongoDB 4.2,
+	// replaces the tags in order and removes empty and duplicated tags
+	pipeline := []bson.M{
+		bson.M{
+			"$set": bson.M{
+				"tags": bson.M{
+					"$reduce": bson.M{
+						"input": bson.M{
+							"$map": bson.M{
+								"input": "$tags",
+								"as":    "tag",
+								"in": bson.M{
+									"$cond": []interface{}{
+										bson.M{"$in": []interface{}{"$$tag", from}},
+										to,
+										"$$tag",
+									},
+								},
+							},
+						},
+						"initialValue": []string{},
+						"in": bson.M{
+							"$cond": []interface{}{
+								bson.M{
+									"$or": []interface{}{
+										bson.M{"$eq": []interface{}{"$$this", ""}},
+										bson.M{"$in": []interface{}{"$$this", "$$value"}},
+									},
+								},
+								"$$value",
+								bson.M{"$concatArrays": []interface{}{"$$value", []string{"$$this"}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var result struct {
+		Modified    int `bson:"nModified"`
+		WriteErrors []struct {
+			Message string `bson:"errmsg"`
+		} `bson:"writeErrors"`
+	}
+	err = db.Run(bson.D{
+		{Name: "update", Value: "posts"},
+		{Name: "updates", Value: []bson.M{
+			bson.M{
+				"q":     filter,
+				"u":     pipeline,
+				"multi": true,
+			},
+		}},
+	}, &result)
+	if err == nil && len(result.WriteErrors) > 0 {
+		err = errors.New(result.WriteErrors[0].Message)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// the tags are indexed to search posts
+	return result.Modified, indexPosts(db.C("posts"), bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// ErrNoRefreshToken returned when no refresh token found
+var ErrNoRefreshToken = errors.New("no such refresh token")
+
+// RefreshToken returns one refresh token that matches the filter
+func RefreshToken(filter bson.M) (structure.RefreshToken, error) {
+	var token structure.RefreshToken
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("refresh_tokens")
+
+	err := c.Find(filter).One(&token)
+	if err != nil && err == mgo.ErrNotFound {
+		return token, ErrNoRefreshToken
+	}
+
+	return token, err
+}
+
+// InsertRefreshToken inserts a refresh token
+func InsertRefreshToken(token *structure.RefreshToken) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("refresh_tokens")
+
+	if token.ID == nil {
+		token.ID = new(bson.ObjectId)
+	}
+	*token.ID = bson.NewObjectId()
+
+	return c.Insert(token)
+}
+
+// UseRefreshToken marks an unused refresh token as used,
+// ErrNoRefreshToken returned when the token doesn't exist
+// or has already been used
+func UseRefreshToken(id bson.ObjectId) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("refresh_tokens")
+
+	err := c.Update(
+		bson.M{
+			"_id":  id,
+			"used": false,
+		},
+		bson.M{
+			"$set": bson.M{
+				"used": true,
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoRefreshToken
+	}
+
+	return err
+}
+
+// RevokeRefreshTokens revokes all refresh tokens that match the filter
+func RevokeRefreshTokens(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("refresh_tokens")
+
+	_, err := c.UpdateAll(
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"revoked": true,
+			},
+		},
+	)
+	return err
+}
+
+// RevokedTokenCount returns the amount of revoked token that matches the filter
+func RevokedTokenCount(filter bson.M) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("revoked_tokens")
+
+	return c.Find(filter).Count()
+}
+
+// InsertRevokedToken inserts a revoked token
+func InsertRevokedToken(token *structure.RevokedToken) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("revoked_tokens")
+
+	if token.ID == nil {
+		token.ID = new(bson.ObjectId)
+	}
+	*token.ID = bson.NewObjectId()
+
+	return c.Insert(token)
+}
+
+// ErrNoAccessToken returned when no access token found
+var ErrNoAccessToken = errors.New("no such access token")
+
+// AccessTokens returns all access tokens which match the filter
+func AccessTokens(filter bson.M) ([]structure.AccessToken, error) {
+	var tokens []structure.AccessToken
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("access_tokens")
+
+	err := c.Find(filter).All(&tokens)
+
+	return tokens, err
+}
+
+// AccessToken returns one access token that matches the filter
+func AccessToken(filter bson.M) (structure.AccessToken, error) {
+	var token structure.AccessToken
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("access_tokens")
+
+	err := c.Find(filter).One(&token)
+	if err != nil && err == mgo.ErrNotFound {
+		return token, ErrNoAccessToken
+	}
+
+	return token, err
+}
+
+// InsertAccessToken inserts an access token
+func InsertAccessToken(token *structure.AccessToken) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("access_tokens")
+
+	if token.ID == nil {
+		token.ID = new(bson.ObjectId)
+	}
+	*token.ID = bson.NewObjectId()
+
+	return c.Insert(token)
+}
+
+// TouchAccessToken records the time when the access token is used,
+// unless the recorded time is after usedBefore
+func TouchAccessToken(id bson.ObjectId, usedBefore time.Time) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("access_tokens")
+
+	err := c.Update(
+		bson.M{
+			"_id": id,
+			"$or": []bson.M{
+				bson.M{
+					"last_used_at": bson.M{
+						"$exists": false,
+					},
+				},
+				bson.M{
+					"last_used_at": bson.M{
+						"$lt": usedBefore,
+					},
+				},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"last_used_at": time.Now(),
+			},
+		},
+	)
+	if err == mgo.ErrNotFound {
+		// used recently, or removed meanwhile
+		return nil
+	}
+
+	return err
+}
+
+// RemoveAccessTokens removes all access tokens that matches the filter
+func RemoveAccessTokens(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("access_tokens")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
+
+// ErrNoSession returned when no session found
+var ErrNoSession = errors.New("no such session")
+
+// Sessions returns all sessions which match the filter,
+// the recently used ones first
+func Sessions(filter bson.M) ([]structure.Session, error) {
+	var sessions []structure.Session
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("sessions")
+
+	err := c.Find(filter).Sort("-last_seen_at").All(&sessions)
+
+	return sessions, err
+}
+
+// Session returns one session that matches the filter
+func Session(filter bson.M) (structure.Session, error) {
+	var s structure.Session
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("sessions")
+
+	err := c.Find(filter).One(&s)
+	if err != nil && err == mgo.ErrNotFound {
+		return s, ErrNoSession
+	}
+
+	return s, err
+}
+
+// InsertSession inserts a session, the id is kept if it's
+// given since it's the id of the refresh token family
+func InsertSession(s *structure.Session) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("sessions")
+
+	if s.ID == nil {
+		s.ID = new(bson.ObjectId)
+		*s.ID = bson.NewObjectId()
+	}
+
+	return c.Insert(s)
+}
+
+// UpdateSession updates a session that matches the filter,
+// ErrNoSession returned when destination session doesn't exist
+func UpdateSession(filter bson.M, s structure.Session) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("sessions")
+
+	err := c.Update(
+		filter,
+		bson.M{
+			"$set": s,
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoSession
+	}
+
+	return err
+}
+
+// RemoveSessions removes all sessions that matches the filter
+func RemoveSessions(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("sessions")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
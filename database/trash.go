@@ -0,0 +1,270 @@
+package database
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/render"
+	"github.com/jaaaaason/hmblog/search"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// notDeleted excludes the documents in trash from the filter,
+// unless the filter is already on "deleted_at"
+func notDeleted(filter bson.M) bson.M {
+	if _, ok := filter["deleted_at"]; ok {
+		return filter
+	}
+
+	result := bson.M{
+		"deleted_at": bson.M{
+			"$exists": false,
+		},
+	}
+	for key, value := range filter {
+		result[key] = value
+	}
+
+	return result
+}
+
+// inTrash returns the filter of the documents in trash
+// which also match the filter
+func inTrash(filter bson.M) bson.M {
+	result := bson.M{
+		"deleted_at": bson.M{
+			"$exists": true,
+		},
+	}
+	for key, value := range filter {
+		result[key] = value
+	}
+
+	return result
+}
+
+// TrashPosts moves all posts that matches the filter to trash,
+// they are hidden from the listings and search until restored
+func TrashPosts(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	filter = notDeleted(filter)
+	ids, err := postIDs(c, filter)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	filter["_id"] = bson.M{
+		"$in": ids,
+	}
+	_, err = c.UpdateAll(
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"deleted_at": time.Now(),
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		render.Invalidate(id.Hex())
+		search.Remove(id.Hex())
+	}
+	return nil
+}
+
+// DeletedPosts retrieves the posts in trash that matches
+// the filter, the latest deleted post first
+func DeletedPosts(filter bson.M) ([]structure.Post, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	var posts []structure.Post
+	err := c.Find(inTrash(filter)).Sort("-deleted_at").All(&posts)
+
+	return posts, err
+}
+
+// RestorePost moves a post that matches the filter out of trash,
+// ErrNoPost returned when the post isn't in trash
+func RestorePost(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("posts")
+
+	var restored structure.Post
+	_, err := c.Find(inTrash(filter)).Apply(mgo.Change{
+		Update: bson.M{
+			"$unset": bson.M{
+				"deleted_at": "",
+			},
+		},
+		ReturnNew: true,
+	}, &restored)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrNoPost
+		}
+		return err
+	}
+
+	search.Index(searchDocument(restored))
+	return nil
+}
+
+// PurgePosts removes the posts deleted before the time from database
+// with their revisions and previous slugs, returns the amount of
+// removed posts
+func PurgePosts(before time.Time) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	db := session.DB(dbName)
+
+	ids, err := postIDs(db.C("posts"), bson.M{
+		"deleted_at": bson.M{
+			"$lt": before,
+		},
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	info, err := db.C("posts").RemoveAll(bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.C("post_revisions").RemoveAll(bson.M{
+		"post_id": bson.M{
+			"$in": ids,
+		},
+	})
+	if err != nil {
+		return info.Removed, err
+	}
+
+	_, err = db.C("slug_history").RemoveAll(bson.M{
+		"collection": "posts",
+		"target_id": bson.M{
+			"$in": ids,
+		},
+	})
+
+	return info.Removed, err
+}
+
+// TrashCategories moves all categories that matches the filter to trash
+func TrashCategories(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("categories")
+
+	_, err := c.UpdateAll(
+		notDeleted(filter),
+		bson.M{
+			"$set": bson.M{
+				"deleted_at": time.Now(),
+			},
+		},
+	)
+	return err
+}
+
+// DeletedCategories retrieves the categories in trash that matches
+// the filter, the latest deleted category first
+func DeletedCategories(filter bson.M) ([]structure.Category, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("categories")
+
+	var categories []structure.Category
+	err := c.Find(inTrash(filter)).Sort("-deleted_at").All(&categories)
+
+	return categories, err
+}
+
+// RestoreCategory moves a category that matches the filter out of
+// trash, ErrNoCategory returned when the category isn't in trash
+func RestoreCategory(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("categories")
+
+	err := c.Update(
+		inTrash(filter),
+		bson.M{
+			"$unset": bson.M{
+				"deleted_at": "",
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoCategory
+	}
+
+	return err
+}
+
+// PurgeCategories removes the categories deleted before the time
+// from database with their previous slugs, returns the amount of
+// removed categories
+func PurgeCategories(before time.Time) (int, error) {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	db := session.DB(dbName)
+
+	var categories []structure.Category
+	err := db.C("categories").Find(bson.M{
+		"deleted_at": bson.M{
+			"$lt": before,
+		},
+	}).Select(bson.M{"_id": 1}).All(&categories)
+	if err != nil || len(categories) == 0 {
+		return 0, err
+	}
+
+	ids := make([]bson.ObjectId, 0, len(categories))
+	for _, category := range categories {
+		ids = append(ids, *category.ID)
+	}
+
+	info, err := db.C("categories").RemoveAll(bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.C("slug_history").RemoveAll(bson.M{
+		"collection": "categories",
+		"target_id": bson.M{
+			"$in": ids,
+		},
+	})
+
+	return info.Removed, err
+}
@@ -1,69 +1,107 @@
 package database
 
 import (
+	"crypto/rand"
 	"errors"
-	"math/rand"
+	"math/big"
+	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 
-	"github.com/jaaaaason/hmblog/logger"
 	"github.com/jaaaaason/hmblog/structure"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// initBlogUser checks if there are blog users in database,
-// create a default blog user "admin" with random password if not
-func initBlogUser() error {
+// migrateUsers updates users created by older versions
+func migrateUsers() error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("users")
+
+	// users created before roles were introduced
+	// had full access, make them owners
+	_, err := c.UpdateAll(
+		bson.M{
+			"role": bson.M{
+				"$exists": false,
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"role": structure.RoleOwner,
+			},
+		},
+	)
+	return err
+}
+
+// InitBlogUser checks if there are blog users in database, create
+// a default blog user "admin" with the given password if not, a random
+// password is used if it isn't given, the user must change the password
+// on first login, the password is hashed with the bcrypt cost,
+// returns the password if the user is created
+func InitBlogUser(password string, cost int) (string, error) {
 	session := mgoSession.Copy()
 	defer session.Close()
 
 	c := session.DB(dbName).C("users")
 	count, err := c.Count()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// has user, no need to create a default one
 	if count > 0 {
-		return nil
+		return "", nil
+	}
+
+	if password == "" {
+		password, err = RandomPassword() // create random password
+		if err != nil {
+			return "", err
+		}
 	}
 
-	username := "admin"
-	psw := randomPassword() // create random password
-	pswHash, err := bcrypt.GenerateFromPassword(psw, bcrypt.DefaultCost)
+	pswHash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	err = c.Insert(bson.M{
-		"username":      username,
-		"password_hash": pswHash,
+	mustChangePassword := true
+	err = InsertUser(&structure.User{
+		Username:           "admin",
+		PasswordHash:       pswHash,
+		Role:               structure.RoleOwner,
+		MustChangePassword: &mustChangePassword,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	logger.Info("created a default user:\n" +
-		"username: " + username + "\n" +
-		"password: " + string(psw))
-
-	return nil
+	return password, nil
 }
 
-// randomPassword creates a 12-length random password
-func randomPassword() []byte {
+// RandomPassword creates a 16-length random password
+// with a cryptographically secure random generator
+func RandomPassword() (string, error) {
 	characters := []byte("0123456789" +
 		"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 		"abcdefghijklmnopqrstuvwxyz")
 
-	psw := make([]byte, 12)
-	for i := 0; i < 12; i++ {
-		psw[i] = characters[rand.Intn(62)]
+	psw := make([]byte, 16)
+	max := big.NewInt(int64(len(characters)))
+	for i := range psw {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		psw[i] = characters[n.Int64()]
 	}
 
-	return psw
+	return string(psw), nil
 }
 
 // ErrNoUser returned when no user found
@@ -122,3 +160,308 @@ func UpdateUser(filter bson.M, user structure.User) error {
 
 	return err
 }
+
+// InsertUser inserts a user
+func InsertUser(user *structure.User) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("users")
+
+	if user.ID == nil {
+		user.ID = new(bson.ObjectId)
+	}
+	*user.ID = bson.NewObjectId()
+
+	return c.Insert(user)
+}
+
+// RemoveUsers removes all users that matches the filter
+func RemoveUsers(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("users")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
+
+// ErrNoInvitation returned when no invitation found
+var ErrNoInvitation = errors.New("no such invitation")
+
+// Invitation returns one invitation that matches the filter
+func Invitation(filter bson.M) (structure.Invitation, error) {
+	var invitation structure.Invitation
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("invitations")
+
+	err := c.Find(filter).One(&invitation)
+	if err != nil && err == mgo.ErrNotFound {
+		return invitation, ErrNoInvitation
+	}
+
+	return invitation, err
+}
+
+// InsertInvitation inserts an invitation
+func InsertInvitation(invitation *structure.Invitation) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("invitations")
+
+	if invitation.ID == nil {
+		invitation.ID = new(bson.ObjectId)
+	}
+	*invitation.ID = bson.NewObjectId()
+
+	return c.Insert(invitation)
+}
+
+// UseInvitation removes the invitation that matches the filter and
+// returns it, so an invitation can only be used once, ErrNoInvitation
+// returned when it doesn't exist
+func UseInvitation(filter bson.M) (structure.Invitation, error) {
+	var invitation structure.Invitation
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("invitations")
+
+	_, err := c.Find(filter).Apply(mgo.Change{Remove: true}, &invitation)
+	if err != nil && err == mgo.ErrNotFound {
+		return invitation, ErrNoInvitation
+	}
+
+	return invitation, err
+}
+
+// RemoveInvitations removes all invitations that matches the filter
+func RemoveInvitations(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("invitations")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
+
+// ErrNoPasswordReset returned when no password reset found
+var ErrNoPasswordReset = errors.New("no such password reset")
+
+// PasswordReset returns one password reset that matches the filter
+func PasswordReset(filter bson.M) (structure.PasswordReset, error) {
+	var reset structure.PasswordReset
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("password_resets")
+
+	err := c.Find(filter).One(&reset)
+	if err != nil && err == mgo.ErrNotFound {
+		return reset, ErrNoPasswordReset
+	}
+
+	return reset, err
+}
+
+// InsertPasswordReset inserts a password reset
+func InsertPasswordReset(reset *structure.PasswordReset) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("password_resets")
+
+	if reset.ID == nil {
+		reset.ID = new(bson.ObjectId)
+	}
+	*reset.ID = bson.NewObjectId()
+
+	return c.Insert(reset)
+}
+
+// RemovePasswordResets removes all password resets that matches the filter
+func RemovePasswordResets(filter bson.M) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("password_resets")
+
+	_, err := c.RemoveAll(filter)
+	return err
+}
+
+// UsePasswordReset removes the password reset that matches the filter
+// and returns it, so a reset token can only be used once,
+// ErrNoPasswordReset returned when it doesn't exist
+func UsePasswordReset(filter bson.M) (structure.PasswordReset, error) {
+	var reset structure.PasswordReset
+
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	c := session.DB(dbName).C("password_resets")
+
+	_, err := c.Find(filter).Apply(mgo.Change{Remove: true}, &reset)
+	if err != nil && err == mgo.ErrNotFound {
+		return reset, ErrNoPasswordReset
+	}
+
+	return reset, err
+}
+
+// ErrPasswordResetSent returned when a password reset link has been
+// sent to the user recently
+var ErrPasswordResetSent = errors.New("password reset has been sent recently")
+
+// SetPasswordResetSent records the time a password reset link is sent
+// to the user, ErrPasswordResetSent returned when the last one was sent
+// after sentBefore, so the links can't be sent too frequently
+func SetPasswordResetSent(id bson.ObjectId, sentBefore time.Time) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("users")
+
+	err := c.Update(
+		bson.M{
+			"_id": id,
+			"$or": []bson.M{
+				bson.M{
+					"password_reset_sent_at": bson.M{
+						"$lt": sentBefore,
+					},
+				},
+				bson.M{
+					"password_reset_sent_at": bson.M{
+						"$exists": false,
+					},
+				},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"password_reset_sent_at": time.Now(),
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrPasswordResetSent
+	}
+
+	return err
+}
+
+// ErrTOTPCodeUsed returned when the TOTP code of the time step,
+// or of a later time step, has been used
+var ErrTOTPCodeUsed = errors.New("totp code has been used")
+
+// UseTOTPStep records the time step of a TOTP code used by the user,
+// ErrTOTPCodeUsed returned when the step isn't later than the last one,
+// which prevents a TOTP code from being replayed
+func UseTOTPStep(id bson.ObjectId, step int64) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("users")
+
+	err := c.Update(
+		bson.M{
+			"_id": id,
+			"$or": []bson.M{
+				bson.M{
+					"totp_last_step": bson.M{
+						"$lt": step,
+					},
+				},
+				bson.M{
+					"totp_last_step": bson.M{
+						"$exists": false,
+					},
+				},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"totp_last_step": step,
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrTOTPCodeUsed
+	}
+
+	return err
+}
+
+// ErrNoRecoveryCode returned when no recovery code found
+var ErrNoRecoveryCode = errors.New("no such recovery code")
+
+// UseRecoveryCode removes a recovery code from the user,
+// ErrNoRecoveryCode returned when the user doesn't have it
+func UseRecoveryCode(id bson.ObjectId, codeHash string) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("users")
+
+	err := c.Update(
+		bson.M{
+			"_id":            id,
+			"recovery_codes": codeHash,
+		},
+		bson.M{
+			"$pull": bson.M{
+				"recovery_codes": codeHash,
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoRecoveryCode
+	}
+
+	return err
+}
+
+// DisableTOTP disables two-factor authentication of the user and
+// removes the TOTP secret and recovery codes
+func DisableTOTP(id bson.ObjectId) error {
+	session := mgoSession.Copy()
+	defer session.Close()
+
+	// set safe mode to return ErrNotFound if a document isn't found
+	session.SetSafe(&mgo.Safe{})
+	c := session.DB(dbName).C("users")
+
+	err := c.UpdateId(
+		id,
+		bson.M{
+			"$set": bson.M{
+				"totp_enabled": false,
+			},
+			"$unset": bson.M{
+				"totp_secret":    "",
+				"totp_last_step": "",
+				"recovery_codes": "",
+			},
+		},
+	)
+	if err != nil && err == mgo.ErrNotFound {
+		return ErrNoUser
+	}
+
+	return err
+}
@@ -0,0 +1,188 @@
+// Package diff computes the line differences between texts
+// and formats them as unified diff
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines the unchanged lines around a change in a hunk
+const contextLines = 3
+
+// op an operation of the edit script, kind is ' ' for
+// an unchanged line, '-' for a deleted line and '+' for
+// an inserted line
+type op struct {
+	kind byte
+	line string
+}
+
+// splitLines splits the text into lines, each line keeps its newline
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// editScript returns the shortest edit script from a to b
+// with the Myers' difference algorithm
+func editScript(a []string, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+
+	// v[offset+k] is the furthest x on diagonal k,
+	// trace keeps v before each round to walk back
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				// move down
+				x = v[offset+k+1]
+			} else {
+				// move right
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back from the end to the start
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, op{' ', a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{'+', b[y-1]})
+			} else {
+				ops = append(ops, op{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	// reverse to the order from start to end
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return ops
+}
+
+// hunkRange formats the range of a hunk, start is the
+// number of lines before the hunk
+func hunkRange(start int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// Unified returns the unified diff from text a to text b, the names
+// are shown in the header, it's empty if the texts are the same
+func Unified(fromName string, toName string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+
+	ops := editScript(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// the line numbers before each operation
+	aLines := make([]int, len(ops)+1)
+	bLines := make([]int, len(ops)+1)
+	for i, o := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if o.kind != '+' {
+			aLines[i+1]++
+		}
+		if o.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough,
+		// the contexts of two changes at most 2*contextLines lines
+		// apart touch each other, so they are in the same hunk
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*contextLines+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := end + contextLines + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[stop]-aLines[start]),
+			hunkRange(bLines[start], bLines[stop]-bLines[start]),
+		)
+		for _, o := range ops[start:stop] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = stop
+	}
+
+	return out.String()
+}
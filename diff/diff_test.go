@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns n lines "line 1" to "line n",
+// the lines in changes are replaced, counting from 1
+func numbered(n int, changes map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := changes[i]; ok {
+			b.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+
+	return b.String()
+}
+
+// the expected outputs are produced by
+// "diff -u --label a --label b a b" of GNU diffutils
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			"same",
+			numbered(3, nil),
+			numbered(3, nil),
+			"",
+		},
+		{
+			"change",
+			numbered(10, nil),
+			numbered(10, map[int]string{5: "changed 5"}),
+			`--- a
++++ b
+@@ -2,7 +2,7 @@
+ line 2
+ line 3
+ line 4
+-line 5
++changed 5
+ line 6
+ line 7
+ line 8
+`,
+		},
+		{
+			"insert at start",
+			numbered(5, nil),
+			"new\n" + numbered(5, nil),
+			`--- a
++++ b
+@@ -1,3 +1,4 @@
++new
+ line 1
+ line 2
+ line 3
+`,
+		},
+		{
+			"delete at end",
+			numbered(6, nil),
+			numbered(5, nil),
+			`--- a
++++ b
+@@ -3,4 +3,3 @@
+ line 3
+ line 4
+ line 5
+-line 6
+`,
+		},
+		{
+			"two hunks",
+			numbered(20, nil),
+			numbered(20, map[int]string{2: "x", 18: "y"}),
+			`--- a
++++ b
+@@ -1,5 +1,5 @@
+ line 1
+-line 2
++x
+ line 3
+ line 4
+ line 5
+@@ -15,6 +15,6 @@
+ line 15
+ line 16
+ line 17
+-line 18
++y
+ line 19
+ line 20
+`,
+		},
+		{
+			"six unchanged lines merge hunks",
+			numbered(20, nil),
+			numbered(20, map[int]string{3: "x", 10: "y"}),
+			`--- a
++++ b
+@@ -1,13 +1,13 @@
+ line 1
+ line 2
+-line 3
++x
+ line 4
+ line 5
+ line 6
+ line 7
+ line 8
+ line 9
+-line 10
++y
+ line 11
+ line 12
+ line 13
+`,
+		},
+		{
+			"seven unchanged lines split hunks",
+			numbered(20, nil),
+			numbered(20, map[int]string{3: "x", 11: "y"}),
+			`--- a
++++ b
+@@ -1,6 +1,6 @@
+ line 1
+ line 2
+-line 3
++x
+ line 4
+ line 5
+ line 6
+@@ -8,7 +8,7 @@
+ line 8
+ line 9
+ line 10
+-line 11
++y
+ line 12
+ line 13
+ line 14
+`,
+		},
+		{
+			"from empty",
+			"",
+			"a\nb\n",
+			`--- a
++++ b
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			"to empty",
+			"a\nb\n",
+			"",
+			`--- a
++++ b
+@@ -1,2 +0,0 @@
+-a
+-b
+`,
+		},
+		{
+			"no newline at end",
+			"a\nb\nc",
+			"a\nb\nd",
+			`--- a
++++ b
+@@ -1,3 +1,3 @@
+ a
+ b
+-c
+\ No newline at end of file
++d
+\ No newline at end of file
+`,
+		},
+		{
+			"newline added at end",
+			"a\nb",
+			"a\nb\n",
+			`--- a
++++ b
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// accessTokenPrefix the prefix of personal access token,
+// which tells it from jwt token
+const accessTokenPrefix = "hmb_"
+
+// the scopes of personal access token
+const (
+	ScopePostRead      = "posts:read"
+	ScopePostWrite     = "posts:write"
+	ScopeCategoryRead  = "categories:read"
+	ScopeCategoryWrite = "categories:write"
+)
+
+// accessTokenScopes all valid scopes of personal access token
+var accessTokenScopes = []string{
+	ScopePostRead,
+	ScopePostWrite,
+	ScopeCategoryRead,
+	ScopeCategoryWrite,
+}
+
+// hasScope reports whether the scope is in scopes
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetAccessTokens handles the GET request for url path "/admin/tokens",
+// returns the personal access tokens of current user
+func GetAccessTokens(c *gin.Context) {
+	tokens, err := database.AccessTokens(bson.M{
+		"user_id": bson.ObjectIdHex(c.GetString("user_id")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// PostAccessToken handles the POST request for url path "/admin/tokens",
+// the token is only returned in this response
+func PostAccessToken(c *gin.Context) {
+	newToken := new(structure.NewAccessToken)
+	if err := c.ShouldBindJSON(newToken); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	// trim space
+	newToken.Name = strings.TrimSpace(newToken.Name)
+	if newToken.Name == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Name shouldn't be just some whitespace",
+		})
+		return
+	}
+
+	if len(newToken.Scopes) == 0 || newToken.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	for _, scope := range newToken.Scopes {
+		if !hasScope(accessTokenScopes, scope) {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid scope " + scope,
+			})
+			return
+		}
+	}
+
+	tokenString, err := randomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	tokenString = accessTokenPrefix + tokenString
+
+	userID := bson.ObjectIdHex(c.GetString("user_id"))
+	token := structure.AccessToken{
+		Name:      newToken.Name,
+		TokenHash: hashToken(tokenString),
+		UserID:    &userID,
+		Scopes:    newToken.Scopes,
+		CreatedAt: time.Now(),
+	}
+	if newToken.ExpiresIn > 0 {
+		expiresAt := token.CreatedAt.Add(time.Second * time.Duration(newToken.ExpiresIn))
+		token.ExpiresAt = &expiresAt
+	}
+
+	err = database.InsertAccessToken(&token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the token itself is never logged, only its hash is stored
+	audit(c, structure.AuditTokenCreate, token.ID.Hex(), nil, &token)
+
+	c.JSON(http.StatusCreated, newAccessTokenRes{
+		AccessToken: token,
+		Token:       tokenString,
+	})
+}
+
+// DeleteAccessToken handles the DELETE request for
+// url path "/admin/tokens/:id", revokes the token
+func DeleteAccessToken(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	// only the owner can delete the token
+	filter := bson.M{
+		"_id":     oid,
+		"user_id": bson.ObjectIdHex(c.GetString("user_id")),
+	}
+
+	token, err := database.AccessToken(filter)
+	if err != nil {
+		if err == database.ErrNoAccessToken {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No access token found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.RemoveAccessTokens(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, structure.AuditTokenDelete, oid.Hex(), &token, nil)
+	c.JSON(http.StatusNoContent, nil)
+}
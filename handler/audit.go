@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditRedacted the fields whose values are never written to audit log,
+// only the fact that they changed is recorded
+var auditRedacted = map[string]bool{
+	"password_hash":  true,
+	"totp_secret":    true,
+	"totp_last_step": true,
+	"recovery_codes": true,
+	"token_hash":     true,
+}
+
+// auditFields returns the stored fields of the document
+func auditFields(doc interface{}) bson.M {
+	fields := bson.M{}
+	value := reflect.ValueOf(doc)
+	if doc == nil || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return fields
+	}
+
+	bytes, err := bson.Marshal(doc)
+	if err == nil {
+		bson.Unmarshal(bytes, &fields)
+	}
+
+	return fields
+}
+
+// auditDiff returns the fields changed between the documents,
+// before is nil for a created document and after is nil for
+// a removed one
+func auditDiff(before interface{}, after interface{}) map[string]structure.AuditChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+
+	diff := make(map[string]structure.AuditChange)
+	for key, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[key]) {
+			diff[key] = structure.AuditChange{Before: value, After: afterFields[key]}
+		}
+	}
+	for key, value := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			diff[key] = structure.AuditChange{After: value}
+		}
+	}
+
+	for key, change := range diff {
+		if auditRedacted[key] {
+			if change.Before != nil {
+				change.Before = "[redacted]"
+			}
+			if change.After != nil {
+				change.After = "[redacted]"
+			}
+			diff[key] = change
+		}
+	}
+
+	return diff
+}
+
+// audit writes an audit log entry of the mutation made by
+// the current user, before and after are pointers to the target
+// document, failures are logged without failing the request
+func audit(c *gin.Context, action string, targetID string, before interface{}, after interface{}) {
+	var actorID *bson.ObjectId
+	if bson.IsObjectIdHex(c.GetString("user_id")) {
+		actorID = new(bson.ObjectId)
+		*actorID = bson.ObjectIdHex(c.GetString("user_id"))
+	}
+
+	auditAs(c, actorID, action, targetID, before, after)
+}
+
+// auditAs writes an audit log entry of the action made by the actor,
+// the actor is nil if it's unknown, such as a failed login
+func auditAs(c *gin.Context, actorID *bson.ObjectId, action string, targetID string, before interface{}, after interface{}) {
+	entry := structure.AuditEntry{
+		ActorID:   actorID,
+		IP:        c.ClientIP(),
+		Action:    action,
+		TargetID:  targetID,
+		Diff:      auditDiff(before, after),
+		CreatedAt: time.Now(),
+	}
+
+	err := database.InsertAuditEntry(&entry)
+	if err != nil {
+		logger.Error("failed to write audit log: " + err.Error())
+	}
+}
+
+// GetAuditLog handles the GET request for url path "/admin/audit",
+// the entries can be filtered by query parameters "actor", "action",
+// "target", "since" and "until", the time is in RFC 3339 format,
+// the latest "limit" entries are returned
+func GetAuditLog(c *gin.Context) {
+	filter := bson.M{}
+
+	if actor := c.Query("actor"); actor != "" {
+		if !bson.IsObjectIdHex(actor) {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invaild actor id",
+			})
+			return
+		}
+		filter["actor_id"] = bson.ObjectIdHex(actor)
+	}
+
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+
+	if target := c.Query("target"); target != "" {
+		filter["target_id"] = target
+	}
+
+	createdAt := bson.M{}
+	for param, operator := range map[string]string{"since": "$gte", "until": "$lt"} {
+		if c.Query(param) == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, c.Query(param))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid time " + param,
+			})
+			return
+		}
+		createdAt[operator] = t
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	limit := defaultAuditLimit
+	if c.Query("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid limit",
+			})
+			return
+		}
+	}
+
+	entries, err := database.AuditEntries(filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if entries == nil {
+		entries = []structure.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// isWebURL reports whether the string is an absolute http or https url
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validProfile reports whether the urls in the profile of user are valid,
+// empty strings are allowed since the fields are optional
+func validProfile(user structure.User) bool {
+	if user.AvatarURL != "" && !isWebURL(user.AvatarURL) {
+		return false
+	}
+
+	if user.Website != "" && !isWebURL(user.Website) {
+		return false
+	}
+
+	for name, link := range user.SocialLinks {
+		if name == "" || !isWebURL(link) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetAuthor handles the GET request of url path "/users/:id",
+// returns the public profile of the author with published post count
+func GetAuthor(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	count, err := database.PostCount(bson.M{
+		"user_id":    oid,
+		"is_publish": true,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	author := user.Author()
+	author.PostCount = &count
+
+	c.JSON(http.StatusOK, author)
+}
+
+// GetAuthorPosts handles the GET request of url path
+// "/users/:id/posts", returns the published posts of the author
+func GetAuthorPosts(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	query, ok := parsePostFilter(c, false)
+	if !ok {
+		return
+	}
+	filter := andFilter(bson.M{
+		"user_id":    oid,
+		"is_publish": true,
+	}, query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	author := user.Author()
+	for i := range posts {
+		posts[i].User = author
+
+		if err := postRelations(&posts[i], publishedFilter); err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	if posts == nil {
+		posts = []structure.Post{}
+	}
+
+	if !renderPosts(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
+	c.JSON(http.StatusOK, posts)
+}
@@ -14,7 +14,21 @@ import (
 
 // GetCategories handles GET request for url path "/categories"
 func GetCategories(c *gin.Context) {
-	categories, err := database.Categories(nil)
+	page, ok := parsePagination(c, "_id")
+	if !ok {
+		return
+	}
+
+	total, err := database.CategoryCount(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	categories, err := database.CategoriesPage(page.filter(nil), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -39,6 +53,7 @@ func GetCategories(c *gin.Context) {
 		}
 	}
 
+	setPageHeaders(c, page, total, len(categories), categoryCursor(page, categories))
 	c.JSON(http.StatusOK, categories)
 }
 
@@ -74,9 +89,16 @@ func GetCategory(c *gin.Context) {
 		return
 	}
 
-	categories[0].PostCount, err = database.PostCount(
+	respondCategory(c, categories[0])
+}
+
+// respondCategory responds with the category
+// and the amount of its published posts
+func respondCategory(c *gin.Context, category structure.Category) {
+	var err error
+	category.PostCount, err = database.PostCount(
 		bson.M{
-			"category_id": categories[0].ID,
+			"category_id": category.ID,
 			"is_publish":  true,
 		},
 	)
@@ -88,12 +110,81 @@ func GetCategory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, categories[0])
+	c.JSON(http.StatusOK, category)
+}
+
+// GetCategoryBySlug handles GET request for url path
+// "/category-slugs/:slug", a previous slug of the
+// category is redirected to the current one
+func GetCategoryBySlug(c *gin.Context) {
+	categories, err := database.Categories(bson.M{
+		"slug": c.Param("slug"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if len(categories) > 0 {
+		respondCategory(c, categories[0])
+		return
+	}
+
+	history, err := database.SlugHistory("categories", c.Param("slug"))
+	if err != nil && err != database.ErrNoSlugHistory {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if history != nil {
+		categories, err = database.Categories(bson.M{
+			"_id": history.TargetID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+
+		// not a permanent redirect, the old slug
+		// may be taken by another one later
+		if len(categories) > 0 && categories[0].Slug != "" {
+			c.Redirect(http.StatusFound, "/category-slugs/"+categories[0].Slug)
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, errRes{
+		Status:  http.StatusNotFound,
+		Message: "No category found",
+	})
 }
 
 // GetAdminCategories handles GET request for url path "/admin/categories"
 func GetAdminCategories(c *gin.Context) {
-	categories, err := database.Categories(nil)
+	page, ok := parsePagination(c, "_id")
+	if !ok {
+		return
+	}
+
+	total, err := database.CategoryCount(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	categories, err := database.CategoriesPage(page.filter(nil), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -111,24 +202,15 @@ func GetAdminCategories(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
 	for i := range categories {
 		// count published post or
 		// unpublish post that belongs to current user
 		categories[i].PostCount, err = database.PostCount(
-			bson.M{
-				"$or": []bson.M{
-					bson.M{
-						"category_id": categories[i].ID,
-						"is_publish":  true,
-					},
-					bson.M{
-						"category_id": categories[i].ID,
-						"is_publish":  false,
-						"user_id":     userID,
-					},
-				},
-			},
+			visiblePostFilter(userID, role, bson.M{
+				"category_id": categories[i].ID,
+			}),
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, errRes{
@@ -139,6 +221,7 @@ func GetAdminCategories(c *gin.Context) {
 		}
 	}
 
+	setPageHeaders(c, page, total, len(categories), categoryCursor(page, categories))
 	c.JSON(http.StatusOK, categories)
 }
 
@@ -164,6 +247,7 @@ func GetAdminCategory(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
 	categories, err := database.Categories(bson.M{
 		"_id": oid,
@@ -187,19 +271,9 @@ func GetAdminCategory(c *gin.Context) {
 	// count published post or
 	// unpublish post that belongs to current user
 	categories[0].PostCount, err = database.PostCount(
-		bson.M{
-			"$or": []bson.M{
-				bson.M{
-					"category_id": categories[0].ID,
-					"is_publish":  true,
-				},
-				bson.M{
-					"category_id": categories[0].ID,
-					"is_publish":  false,
-					"user_id":     userID,
-				},
-			},
-		},
+		visiblePostFilter(userID, role, bson.M{
+			"category_id": categories[0].ID,
+		}),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
@@ -254,6 +328,12 @@ func PostCategory(c *gin.Context) {
 		return
 	}
 
+	slug, ok := resolveSlug(c, "categories", category.Slug, category.Name, "", nil)
+	if !ok {
+		return
+	}
+	category.Slug = slug
+
 	err = database.InsertCategory(category)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
@@ -263,6 +343,7 @@ func PostCategory(c *gin.Context) {
 		return
 	}
 
+	audit(c, structure.AuditCategoryCreate, category.ID.Hex(), nil, category)
 	c.JSON(http.StatusCreated, category)
 }
 
@@ -299,6 +380,8 @@ func UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	originCategory := categories[0]
+
 	var category structure.Category
 	if c.Request.Method == "PUT" {
 		// for PUT request, use a new category struct,
@@ -366,6 +449,12 @@ func UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	slug, ok := resolveSlug(c, "categories", category.Slug, category.Name, originCategory.Slug, &oid)
+	if !ok {
+		return
+	}
+	category.Slug = slug
+
 	err = database.UpdateCategory(
 		bson.M{
 			"_id": oid,
@@ -380,12 +469,15 @@ func UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	moveSlug("categories", oid, originCategory.Slug, category.Slug)
+
 	category.ID = &oid
+	audit(c, structure.AuditCategoryUpdate, oid.Hex(), &originCategory, &category)
 	c.JSON(http.StatusCreated, category)
 }
 
-// DeleteCategory handles the DELETE request
-// of url path "/admin/categories/:id"
+// DeleteCategory handles the DELETE request of url path
+// "/admin/categories/:id", the category is moved to trash
 func DeleteCategory(c *gin.Context) {
 	// parse object id from url path
 	if !bson.IsObjectIdHex(c.Param("id")) {
@@ -397,7 +489,7 @@ func DeleteCategory(c *gin.Context) {
 	}
 	oid := bson.ObjectIdHex(c.Param("id"))
 
-	err := database.RemoveCategories(bson.M{
+	categories, err := database.Categories(bson.M{
 		"_id": oid,
 	})
 	if err != nil {
@@ -408,5 +500,21 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
+	// the category is kept in trash until it's purged
+	err = database.TrashCategories(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if len(categories) > 0 {
+		audit(c, structure.AuditCategoryDelete, oid.Hex(), &categories[0], nil)
+	}
+
 	c.JSON(http.StatusNoContent, nil)
 }
@@ -0,0 +1,70 @@
+package handler
+
+// commonPasswords the most common passwords of leaked password lists,
+// which are rejected by the password policy, passwords are compared in
+// lower case, the ones shorter than defaultPasswordMinLength are left
+// out since they're rejected by the length anyway
+var commonPasswords = map[string]bool{
+	"password": true, "12345678": true, "123456789": true,
+	"1234567890": true, "11111111": true, "00000000": true,
+	"87654321": true, "987654321": true, "88888888": true,
+	"12341234": true, "11223344": true, "12344321": true,
+	"123123123": true, "1q2w3e4r": true, "1qaz2wsx": true,
+	"qwertyuiop": true, "qwerty123": true, "qwerty12": true,
+	"password1": true, "password12": true, "password123": true,
+	"passw0rd": true, "p@ssw0rd": true, "p@ssword": true,
+	"iloveyou": true, "iloveyou1": true, "iloveyou2": true,
+	"princess": true, "princess1": true, "sunshine": true,
+	"sunshine1": true, "football": true, "football1": true,
+	"baseball": true, "baseball1": true, "superman": true,
+	"superman1": true, "starwars": true, "starwars1": true,
+	"trustno1": true, "welcome1": true, "welcome123": true,
+	"whatever": true, "jennifer": true, "michelle": true,
+	"jessica1": true, "computer": true, "corvette": true,
+	"midnight": true, "mercedes": true, "elizabeth": true,
+	"christopher": true, "alexander": true, "basketball": true,
+	"butterfly": true, "chocolate": true, "babygirl1": true,
+	"lovely123": true, "qwertyui": true, "asdfghjk": true,
+	"asdfghjkl": true, "zxcvbnm1": true, "zaq12wsx": true,
+	"zaq1zaq1": true, "1qazxsw2": true, "q1w2e3r4": true,
+	"q1w2e3r4t5": true, "1q2w3e4r5t": true, "1q2w3e4r5t6y": true,
+	"abcd1234": true, "abc12345": true, "abcdefgh": true,
+	"aaaaaaaa": true, "asdf1234": true, "qazwsxedc": true,
+	"123qweasd": true, "1234qwer": true, "qwer1234": true,
+	"letmein1": true, "letmein123": true, "monkey123": true,
+	"dragon123": true, "master123": true, "shadow123": true,
+	"admin123": true, "administrator": true, "changeme": true,
+	"changeme1": true, "default1": true, "secret123": true,
+	"football123": true, "baseball123": true, "charlie1": true,
+	"michael1": true, "jordan23": true, "batman123": true,
+	"pokemon1": true, "pokemon123": true, "minecraft": true,
+	"minecraft1": true, "liverpool": true, "liverpool1": true,
+	"arsenal1": true, "chelsea1": true, "manchester": true,
+	"barcelona": true, "cristiano": true, "samsung1": true,
+	"samsung123": true, "internet": true, "blink182": true,
+	"slipknot": true, "metallica": true, "nirvana1": true,
+	"password2": true, "password01": true, "passwort": true,
+	"motdepasse": true, "123456789a": true, "a1234567": true,
+	"a12345678": true, "1234567a": true, "12345678a": true,
+	"qwe12345": true, "147258369": true, "741852963": true,
+	"123654789": true, "1111111111": true, "0123456789": true,
+	"999999999": true, "55555555": true, "66666666": true,
+	"77777777": true, "99999999": true, "22222222": true,
+	"12121212": true, "69696969": true, "123321123": true,
+	"147852369": true, "789456123": true, "12345qwert": true,
+	"anthony1": true, "jasmine1": true, "jonathan": true,
+	"benjamin": true, "victoria": true, "samantha": true,
+	"danielle": true, "patricia": true, "veronica": true,
+	"isabella": true, "stephanie": true, "december": true,
+	"november": true, "september": true, "sunflower": true,
+	"rainbow1": true, "tinkerbell": true, "cheyenne": true,
+	"chicken1": true, "hello123": true, "hellokitty": true,
+	"mustang1": true, "thunder1": true, "sweetheart": true,
+	"spiderman": true, "pa55word": true, "test1234": true,
+	"testtest": true, "zxcvbnm123": true, "qwerty1234": true,
+	"asdfasdf": true, "qweqweqwe": true, "abcabc123": true,
+	"qwertyqwerty": true, "google123": true, "facebook": true,
+	"12qwaszx": true, "123456aa": true, "qq123456": true,
+	"woaini1314": true, "woaini520": true, "iloveyou123": true,
+	"loveyou123": true, "hmblog123": true, "myblog123": true,
+}
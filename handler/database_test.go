@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// testDatabase connects to the MongoDB given by environment variable
+// HMBLOG_TEST_MONGODB ("host:port") and uses a new database for the
+// test, the test is skipped if it isn't set, the returned function
+// drops the database
+func testDatabase(t *testing.T) func() {
+	addr := os.Getenv("HMBLOG_TEST_MONGODB")
+	if addr == "" {
+		t.Skip("HMBLOG_TEST_MONGODB isn't set")
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("invalid HMBLOG_TEST_MONGODB: %v", err)
+	}
+	configer.Config.MongoDBHost = host
+	configer.Config.MongoDBListen, err = strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("invalid HMBLOG_TEST_MONGODB: %v", err)
+	}
+	configer.Config.DBName = "hmblog_test_" + bson.NewObjectId().Hex()
+
+	logger.Initialize(os.Stderr)
+	gin.SetMode(gin.TestMode)
+
+	if err = database.Initialize(); err != nil {
+		t.Fatalf("database.Initialize() error = %v", err)
+	}
+
+	return func() {
+		database.CloseSession()
+
+		session, err := mgo.Dial(addr)
+		if err != nil {
+			t.Errorf("failed to drop test database: %v", err)
+			return
+		}
+		defer session.Close()
+
+		session.DB(configer.Config.DBName).DropDatabase()
+	}
+}
+
+// testUser inserts a user with the role and password
+func testUser(t *testing.T, username string, role string, password string) structure.User {
+	user := structure.User{
+		Username: username,
+		Role:     role,
+	}
+	if password != "" {
+		hash, err := HashPassword(password)
+		if err != nil {
+			t.Fatalf("HashPassword() error = %v", err)
+		}
+		user.PasswordHash = hash
+	}
+
+	if err := database.InsertUser(&user); err != nil {
+		t.Fatalf("database.InsertUser() error = %v", err)
+	}
+
+	return user
+}
+
+// testRequest serves the request with a JSON body, the body is
+// omitted if it's nil, header "Authorization" is set if token
+// isn't empty
+func testRequest(r http.Handler, method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/logger"
+)
+
+// jwtKey a key used to sign or verify jwt token
+type jwtKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	signKey     interface{} // nil if the key can only verify token
+	verifyKey   interface{}
+	verifyUntil time.Time // zero value means no limit
+}
+
+var (
+	jwtKeys    = make(map[string]*jwtKey) // all known keys, indexed by kid
+	jwtSignKey *jwtKey                    // the key used to sign new token
+)
+
+func init() {
+	jwt.RegisterSigningMethod(signingMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return signingMethodEdDSA
+	})
+}
+
+// InitializeJWT loads the jwt keys given in configuration,
+// a random HS256 key will be used if no key is given
+func InitializeJWT() error {
+	if len(configer.Config.JWTKeys) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+
+		jwtSignKey = &jwtKey{
+			kid:       "default",
+			method:    jwt.SigningMethodHS256,
+			signKey:   secret,
+			verifyKey: secret,
+		}
+		jwtKeys[jwtSignKey.kid] = jwtSignKey
+
+		logger.Warn("no jwt key is given, using a random key, " +
+			"tokens will be invalid after restarting")
+		return nil
+	}
+
+	for _, conf := range configer.Config.JWTKeys {
+		key, err := loadJWTKey(conf)
+		if err != nil {
+			return fmt.Errorf("jwt key %q: %v", conf.KID, err)
+		}
+
+		if _, ok := jwtKeys[key.kid]; ok {
+			return fmt.Errorf("jwt key %q: duplicate kid", key.kid)
+		}
+		jwtKeys[key.kid] = key
+	}
+
+	kid := configer.Config.JWTSigningKID
+	if kid == "" && len(configer.Config.JWTKeys) == 1 {
+		// only one key, use it to sign token
+		kid = configer.Config.JWTKeys[0].KID
+	}
+
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return fmt.Errorf("jwt signing key %q not found", kid)
+	}
+	if key.signKey == nil {
+		return fmt.Errorf("jwt key %q can't be used to sign token", kid)
+	}
+	jwtSignKey = key
+
+	return nil
+}
+
+// loadJWTKey creates a jwt key with the given configuration
+func loadJWTKey(conf configer.JWTKey) (*jwtKey, error) {
+	if strings.TrimSpace(conf.KID) == "" {
+		return nil, errors.New("kid required")
+	}
+
+	key := &jwtKey{
+		kid:    conf.KID,
+		method: jwt.GetSigningMethod(conf.Algorithm),
+	}
+	if key.method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", conf.Algorithm)
+	}
+
+	if conf.VerifyUntil != "" {
+		var err error
+		key.verifyUntil, err = time.Parse(time.RFC3339, conf.VerifyUntil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := key.method.(*jwt.SigningMethodHMAC); ok {
+		if conf.Secret == "" {
+			return nil, errors.New("secret required")
+		}
+
+		key.signKey = []byte(conf.Secret)
+		key.verifyKey = key.signKey
+		return key, nil
+	}
+
+	if conf.PrivateKeyFile == "" && conf.PublicKeyFile == "" {
+		return nil, errors.New("private_key_file or public_key_file required")
+	}
+
+	if conf.PrivateKeyFile != "" {
+		bytes, err := ioutil.ReadFile(conf.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		key.signKey, key.verifyKey, err = parsePrivateKey(key.method, bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.PublicKeyFile != "" {
+		bytes, err := ioutil.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		key.verifyKey, err = parsePublicKey(key.method, bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// parsePrivateKey parses a PEM encoded private key for the signing method,
+// returns the private key and its public key
+func parsePrivateKey(method jwt.SigningMethod, bytes []byte) (interface{}, interface{}, error) {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	case *jwt.SigningMethodECDSA:
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM(bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	case *signingMethodEd25519:
+		block, _ := pem.Decode(bytes)
+		if block == nil {
+			return nil, nil, errors.New("key must be PEM encoded")
+		}
+
+		parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		privateKey, ok := parsedKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("key is not a valid Ed25519 private key")
+		}
+		return privateKey, privateKey.Public(), nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported algorithm %q", method.Alg())
+}
+
+// parsePublicKey parses a PEM encoded public key for the signing method
+func parsePublicKey(method jwt.SigningMethod, bytes []byte) (interface{}, error) {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return jwt.ParseRSAPublicKeyFromPEM(bytes)
+	case *jwt.SigningMethodECDSA:
+		return jwt.ParseECPublicKeyFromPEM(bytes)
+	case *signingMethodEd25519:
+		block, _ := pem.Decode(bytes)
+		if block == nil {
+			return nil, errors.New("key must be PEM encoded")
+		}
+
+		parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, ok := parsedKey.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("key is not a valid Ed25519 public key")
+		}
+		return publicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported algorithm %q", method.Alg())
+}
+
+// signToken signs a jwt token with the current signing key
+func signToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwtSignKey.method, claims)
+	token.Header["kid"] = jwtSignKey.kid
+
+	return token.SignedString(jwtSignKey.signKey)
+}
+
+// jwtKeyFunc finds the key to verify the token by its "kid" header,
+// the signing method of token must be the same as the key's
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return nil, errors.New("Unknown jwt key")
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("Unexpected signing method")
+	}
+
+	if !key.verifyUntil.IsZero() && time.Now().After(key.verifyUntil) {
+		return nil, errors.New("JWT key is retired")
+	}
+
+	return key.verifyKey, nil
+}
+
+// signingMethodEd25519 implements the EdDSA signing method with Ed25519 keys
+type signingMethodEd25519 struct{}
+
+var signingMethodEdDSA = &signingMethodEd25519{}
+
+// Alg returns the name of the signing method
+func (m *signingMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+// Verify verifies the signature with an ed25519.PublicKey
+func (m *signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Sign signs the string with an ed25519.PrivateKey
+func (m *signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	loginLockoutBase   = 30 * time.Second // lockout after the first failure over threshold
+	loginLockoutMax    = time.Hour        // the longest lockout
+	loginFailureExpiry = 24 * time.Hour   // counter is removed after the last failure
+)
+
+// loginFailureThresholds the failures allowed before lockout for each
+// kind of counter, an ip address may be shared by many users
+var loginFailureThresholds = map[string]int{
+	structure.LoginFailureUsername: 5,
+	structure.LoginFailureIP:       20,
+}
+
+// lockedUntil returns the time until which the login is locked
+// by the counter, the lockout doubles with each failure over
+// the threshold, nil returned if it isn't locked
+func lockedUntil(failure structure.LoginFailure) *time.Time {
+	over := failure.Failures - loginFailureThresholds[failure.Kind]
+	if over < 0 {
+		return nil
+	}
+
+	lockout := loginLockoutMax
+	if over < 32 && loginLockoutBase<<uint(over) < loginLockoutMax {
+		lockout = loginLockoutBase << uint(over)
+	}
+
+	until := failure.LastFailure.Add(lockout)
+	return &until
+}
+
+// loginLockout returns the time until which the login of
+// the username from the ip address is locked, a zero time
+// returned if it isn't locked
+func loginLockout(username string, ip string) (time.Time, error) {
+	failures, err := database.LoginFailures(bson.M{
+		"$or": []bson.M{
+			bson.M{
+				"kind":  structure.LoginFailureUsername,
+				"value": username,
+			},
+			bson.M{
+				"kind":  structure.LoginFailureIP,
+				"value": ip,
+			},
+		},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var lockout time.Time
+	for _, failure := range failures {
+		until := lockedUntil(failure)
+		if until != nil && until.After(time.Now()) && until.After(lockout) {
+			lockout = *until
+		}
+	}
+
+	return lockout, nil
+}
+
+// recordLoginFailure increases the failure counters
+// of the username and the ip address
+func recordLoginFailure(username string, ip string) error {
+	expiresAt := time.Now().Add(loginFailureExpiry)
+
+	_, err := database.IncLoginFailure(structure.LoginFailureUsername, username, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.IncLoginFailure(structure.LoginFailureIP, ip, expiresAt)
+	return err
+}
+
+// resetLoginFailures resets the failure counter of the username,
+// it's called once the whole login succeeds
+func resetLoginFailures(username string) error {
+	return database.RemoveLoginFailures(bson.M{
+		"kind":  structure.LoginFailureUsername,
+		"value": username,
+	})
+}
+
+// abortLockedLogin responds the locked login with the time to retry
+func abortLockedLogin(c *gin.Context, lockout time.Time) {
+	retryAfter := int(time.Until(lockout)/time.Second) + 1
+	c.Header("Retry-After", fmt.Sprint(retryAfter))
+	c.JSON(http.StatusTooManyRequests, errRes{
+		Status:  http.StatusTooManyRequests,
+		Message: "Too many failed login attempts, try again later",
+	})
+}
+
+// GetLockouts handles the GET request for url path "/admin/lockouts",
+// only the locked counters are returned if query parameter "locked" is true
+func GetLockouts(c *gin.Context) {
+	failures, err := database.LoginFailures(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	lockouts := []structure.LoginFailure{}
+	for i := range failures {
+		failures[i].LockedUntil = lockedUntil(failures[i])
+		if failures[i].LockedUntil != nil && failures[i].LockedUntil.Before(time.Now()) {
+			failures[i].LockedUntil = nil
+		}
+
+		if c.Query("locked") == "true" && failures[i].LockedUntil == nil {
+			continue
+		}
+		lockouts = append(lockouts, failures[i])
+	}
+
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// DeleteLockout handles the DELETE request for url path
+// "/admin/lockouts/:id", clears the login failure counter
+func DeleteLockout(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	failures, err := database.LoginFailures(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.RemoveLoginFailures(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if len(failures) > 0 {
+		audit(c, structure.AuditLockoutDelete, oid.Hex(), &failures[0], nil)
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
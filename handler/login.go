@@ -2,9 +2,7 @@ package handler
 
 import (
 	"net/http"
-	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/globalsign/mgo/bson"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,45 +23,88 @@ func PostLogin(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	lockout, err := loginLockout(login.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if !lockout.IsZero() {
+		abortLockedLogin(c, lockout)
+		return
+	}
+
 	// check if user exists
 	user, err := database.User(bson.M{
 		"username": login.Username,
 	})
-	if err != nil {
-		// user not exist
-		if err == database.ErrNoUser {
-			c.JSON(http.StatusNotFound, errRes{
-				Status:  http.StatusNotFound,
-				Message: "No user named " + login.Username,
+	if err != nil && err != database.ErrNoUser {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// compare with a dummy hash if the user doesn't exist or
+	// hasn't set a password, so that the response time doesn't
+	// reveal whether the username exists
+	passwordHash := user.PasswordHash
+	if len(passwordHash) == 0 {
+		passwordHash = dummyHash()
+	}
+
+	pswErr := bcrypt.CompareHashAndPassword(passwordHash, []byte(login.Password))
+	if err == database.ErrNoUser || len(user.PasswordHash) == 0 || pswErr != nil {
+		err = recordLoginFailure(login.Username, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
 			})
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, errRes{
-			Status:  http.StatusInternalServerError,
-			Message: "Internal server error",
+		auditAs(c, nil, structure.AuditLoginFailure, login.Username, nil, nil)
+
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Wrong username or password",
 		})
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(login.Password))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, errRes{
-			Status:  http.StatusBadRequest,
-			Message: "Wrong password",
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
 		})
 		return
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := jwt.MapClaims{
-		"exp": time.Now().Add(time.Second * tokenExp).Unix(),
-		"iat": time.Now().Unix(),
+	if needsRehash(user.PasswordHash) {
+		// upgrade the hash made with an old bcrypt cost
+		if err = rehashPassword(*user.ID, login.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
 	}
-	claims["user_id"] = user.ID
-	token.Claims = claims
 
-	tokenString, err := token.SignedString([]byte(jwtSignKey))
+	if user.IsTOTPEnabled() {
+		// the second step of login is required, the failure
+		// counter is kept until the code is verified
+		respondLoginChallenge(c, *user.ID)
+		return
+	}
+
+	// reset the failure counter of the username
+	err = resetLoginFailures(login.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -72,9 +113,20 @@ func PostLogin(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": tokenString,
-		"token_type":   tokenType,
-		"expires_in":   tokenExp,
-	})
+	res, err := startSession(c, *user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	auditAs(c, user.ID, structure.AuditLogin, user.ID.Hex(), nil, nil)
+
+	if user.IsPasswordChangeRequired() {
+		res["must_change_password"] = true
+	}
+
+	c.JSON(http.StatusOK, res)
 }
@@ -1,86 +1,334 @@
 package handler
 
 import (
-	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
 )
 
 const (
-	jwtSignKey = "secret"
-	tokenType  = "bearer"
-	tokenExp   = 86400 // 1 Day, 86400 seconds
+	tokenType             = "bearer"
+	tokenExp              = 900     // 15 minutes, 900 seconds
+	refreshTokenExp       = 2592000 // 30 days, 2592000 seconds
+	invitationExp         = 604800  // 7 days, 604800 seconds
+	passwordResetExp      = 3600    // 1 hour, 3600 seconds
+	passwordResetInterval = 300     // 5 minutes, 300 seconds
+	lastSeenExp           = 60      // 1 minute, 60 seconds
 )
 
 // JWTMiddleware the middleware for verifying jwt token
 func JWTMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, errRes{
-				Status:  http.StatusUnauthorized,
-				Message: "JWT token required",
+		tokenString, ok := bearerToken(c)
+		if !ok || !verifyJWT(c, tokenString) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AccessTokenMiddleware the middleware for verifying jwt token
+// or personal access token, the scopes of personal access token
+// are checked by ScopeMiddleware
+func AccessTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		if strings.HasPrefix(tokenString, accessTokenPrefix) {
+			ok = verifyAccessToken(c, tokenString)
+		} else {
+			ok = verifyJWT(c, tokenString)
+		}
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ScopeMiddleware the middleware for checking if the personal access
+// token has the scope, it must be used after AccessTokenMiddleware,
+// requests authorized by jwt token are not limited by scopes
+func ScopeMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := c.Get("scopes")
+		if ok && !hasScope(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Access token requires scope " + scope,
 			})
 
 			c.Abort()
 			return
 		}
 
-		tokenStrs := strings.Split(tokenString, " ")
-		if len(tokenStrs) != 2 || tokenStrs[0] != "Bearer" {
+		c.Next()
+	}
+}
+
+// bearerToken gets the token from the Authorization header,
+// responds with an error if there isn't one
+func bearerToken(c *gin.Context) (string, bool) {
+	tokenString := c.GetHeader("Authorization")
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "JWT token required",
+		})
+		return "", false
+	}
+
+	tokenStrs := strings.Split(tokenString, " ")
+	if len(tokenStrs) != 2 || tokenStrs[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid jwt token",
+		})
+		return "", false
+	}
+
+	return tokenStrs[1], true
+}
+
+// verifyJWT verifies the jwt token and sets the current user,
+// responds with an error if the token is invalid
+func verifyJWT(c *gin.Context, tokenString string) bool {
+	token, err := jwt.Parse(tokenString, jwtKeyFunc)
+	if err != nil {
+		v, _ := err.(*jwt.ValidationError)
+		if v.Errors == jwt.ValidationErrorExpired {
+			// jwt token is expired
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "JWT token is expired",
+			})
+		} else {
 			c.JSON(http.StatusUnauthorized, errRes{
 				Status:  http.StatusUnauthorized,
 				Message: "Invalid jwt token",
 			})
-			c.Abort()
-			return
 		}
 
-		token, err := jwt.Parse(tokenStrs[1],
-			func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("Can't parse JWT token")
-				}
+		return false
+	}
+
+	// invalid token
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return false
+	}
+
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	userID, _ := claims["user_id"].(string)
+	if jti == "" || !bson.IsObjectIdHex(sid) || !bson.IsObjectIdHex(userID) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return false
+	}
 
-				return []byte(jwtSignKey), nil
+	// check if the token, or all tokens of
+	// the user issued before it, are revoked
+	count, err := database.RevokedTokenCount(bson.M{
+		"$or": []bson.M{
+			bson.M{
+				"jti": jti,
+			},
+			bson.M{
+				"user_id": bson.ObjectIdHex(userID),
+				"issued_before": bson.M{
+					"$gt": time.Unix(int64(iat), 0),
+				},
+			},
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "JWT token is revoked",
+		})
+		return false
+	}
+
+	// check if the session is revoked
+	filter := bson.M{
+		"_id":     bson.ObjectIdHex(sid),
+		"user_id": bson.ObjectIdHex(userID),
+	}
+	session, err := database.Session(filter)
+	if err == nil && time.Since(session.LastSeenAt) >= lastSeenExp*time.Second {
+		// record the time it's used, at most once in
+		// a while so not every request writes to database
+		err = database.UpdateSession(
+			filter,
+			structure.Session{
+				IP:         c.ClientIP(),
+				UserAgent:  c.Request.UserAgent(),
+				LastSeenAt: time.Now(),
+			},
+		)
+	}
+	if err != nil {
+		if err == database.ErrNoSession {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Session is revoked",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
 			})
-		if err != nil {
-			v, _ := err.(*jwt.ValidationError)
-			if v.Errors == jwt.ValidationErrorExpired {
-				// jwt token is expired
-				c.JSON(http.StatusUnauthorized, errRes{
-					Status:  http.StatusUnauthorized,
-					Message: "JWT token is expired",
-				})
-			} else {
-				c.JSON(http.StatusUnauthorized, errRes{
-					Status:  http.StatusUnauthorized,
-					Message: "Invalid jwt token",
-				})
-			}
+		}
 
-			c.Abort()
-			return
+		return false
+	}
+
+	if !setCurrentUser(c, bson.ObjectIdHex(userID)) {
+		return false
+	}
+
+	c.Set("jti", jti)
+	c.Set("session_id", sid)
+	c.Set("token_exp", time.Unix(int64(exp), 0))
+	return true
+}
+
+// verifyAccessToken verifies the personal access token and sets
+// the current user and the token's scopes, responds with an error
+// if the token is invalid
+func verifyAccessToken(c *gin.Context, tokenString string) bool {
+	token, err := database.AccessToken(bson.M{
+		"token_hash": hashToken(tokenString),
+	})
+	if err != nil {
+		if err == database.ErrNoAccessToken {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid access token",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
 		}
 
-		// invalid token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
+		return false
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Access token is expired",
+		})
+		return false
+	}
+
+	if !setCurrentUser(c, *token.UserID) {
+		return false
+	}
+
+	// record the time it's used, at most once in
+	// a while so not every request writes to database
+	err = database.TouchAccessToken(*token.ID, time.Now().Add(-time.Second*lastSeenExp))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return false
+	}
+
+	c.Set("scopes", token.Scopes)
+	return true
+}
+
+// setCurrentUser sets the id and role of the user who the token
+// is issued to, responds with an error if the user has been
+// removed or disabled after the token is issued
+func setCurrentUser(c *gin.Context, userID bson.ObjectId) bool {
+	user, err := database.User(bson.M{
+		"_id": userID,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
 			c.JSON(http.StatusUnauthorized, errRes{
 				Status:  http.StatusUnauthorized,
 				Message: "Invalid JWT token",
 			})
-
-			c.Abort()
-			return
+		} else {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
 		}
 
-		c.Set("user_id", claims["user_id"])
-		c.Next()
+		return false
+	}
+
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return false
+	}
+
+	if user.IsPasswordChangeRequired() && !passwordChangeAllowed(c, userID) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Password change required",
+		})
+		return false
 	}
+
+	c.Set("user_id", userID.Hex())
+	c.Set("role", user.Role)
+	return true
+}
+
+// passwordChangeAllowed checks if the request is allowed for the user
+// who must change the password, only changing the password and
+// logging out are allowed
+func passwordChangeAllowed(c *gin.Context, userID bson.ObjectId) bool {
+	path := c.Request.URL.Path
+	if c.Request.Method == http.MethodPost && path == "/admin/logout" {
+		return true
+	}
+
+	return c.Request.Method == http.MethodPut &&
+		path == "/admin/users/"+userID.Hex()+"/password"
 }
 
 // CORSMiddleware the middleware for cors
@@ -90,6 +338,7 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTION")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Link, Retry-After")
 
 		c.Next()
 	}
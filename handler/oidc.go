@@ -0,0 +1,708 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	oidcStateExp        = 600 // 10 minutes, 600 seconds
+	oidcJWKSMinInterval = time.Minute
+)
+
+// oidcProvider the metadata of OpenID Connect provider,
+// got from its discovery document
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcJWK a json web key of the provider
+type oidcJWK struct {
+	KID string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var (
+	oidcMutex       sync.Mutex
+	oidcMetadata    *oidcProvider
+	oidcKeys        map[string]interface{} // the provider's keys, indexed by kid
+	oidcKeysFetched time.Time
+
+	oidcClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// errOIDCNoUser returned when no user is linked to the identity
+// and users can't be created on login
+var errOIDCNoUser = errors.New("no user is linked to the identity")
+
+// errOIDCLinkRefused returned when the user with the same email
+// can't be linked to the identity by email
+var errOIDCLinkRefused = errors.New("identity can't be linked to the user")
+
+// oidcEnabled reports whether OpenID Connect login is configured
+func oidcEnabled() bool {
+	return configer.Config.OIDC.Issuer != ""
+}
+
+// getJSON gets the json document of the url into v
+func getJSON(url string, v interface{}) error {
+	res, err := oidcClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// oidcProviderMetadata returns the metadata of the provider,
+// the discovery document is fetched once and cached
+func oidcProviderMetadata() (*oidcProvider, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcMetadata != nil {
+		return oidcMetadata, nil
+	}
+
+	issuer := strings.TrimSuffix(configer.Config.OIDC.Issuer, "/")
+
+	provider := new(oidcProvider)
+	err := getJSON(issuer+"/.well-known/openid-configuration", provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("issuer %q doesn't match the configured one", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" ||
+		provider.JWKSURI == "" {
+		return nil, errors.New("incomplete discovery document")
+	}
+
+	oidcMetadata = provider
+	return oidcMetadata, nil
+}
+
+// oidcKey returns the provider's key with the kid, the keys are
+// fetched again when the kid is unknown, since the provider may
+// have rotated its keys, but not more often than oidcJWKSMinInterval
+func oidcKey(provider *oidcProvider, kid string) (interface{}, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if key, ok := oidcKeys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(oidcKeysFetched) < oidcJWKSMinInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	oidcKeysFetched = time.Now()
+
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	err := getJSON(provider.JWKSURI, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcKeys = make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseJWK(jwk)
+		if err != nil {
+			// skip the keys of unsupported types
+			continue
+		}
+		oidcKeys[jwk.KID] = key
+	}
+
+	key, ok := oidcKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+// parseJWK parses the public key of a json web key
+func parseJWK(jwk oidcJWK) (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid ec key")
+		}
+		return key, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// exchangeOIDCCode exchanges the authorization code
+// for the id token at the provider's token endpoint
+func exchangeOIDCCode(provider *oidcProvider, code string, codeVerifier string) (string, error) {
+	conf := configer.Config.OIDC
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", conf.RedirectURL)
+	form.Set("client_id", conf.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		provider.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&tokens)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s %s %s",
+			res.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token returned")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// verifyIDToken verifies the signature and claims of the id token,
+// returns the claims if it's valid
+func verifyIDToken(provider *oidcProvider, idToken string, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		// only asymmetric algorithms are accepted, the client
+		// secret must not be usable as a verification key
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS,
+			*jwt.SigningMethodECDSA, *signingMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected algorithm %q", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return oidcKey(provider, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid id token")
+	}
+
+	clientID := configer.Config.OIDC.ClientID
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, errors.New("id token: wrong issuer")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("id token: no expiration time")
+	}
+
+	// the audience is either a string or an array of strings
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	hasAudience := false
+	for _, aud := range audiences {
+		if aud == clientID {
+			hasAudience = true
+		}
+	}
+	if !hasAudience {
+		return nil, errors.New("id token: wrong audience")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != clientID {
+		return nil, errors.New("id token: wrong authorized party")
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("id token: wrong nonce")
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id token: no subject")
+	}
+
+	return claims, nil
+}
+
+// oidcUser returns the user linked to the identity of id token,
+// the identity is linked to the user with the same verified email
+// if LinkByEmail is set, or a new user is created if AutoCreate is set,
+// errOIDCNoUser returned if no user is found, errOIDCLinkRefused
+// returned if the user with the email can't be linked
+func oidcUser(c *gin.Context, issuer string, claims jwt.MapClaims) (structure.User, error) {
+	conf := configer.Config.OIDC
+	subject, _ := claims["sub"].(string)
+
+	user, err := database.User(bson.M{
+		"oidc_issuer":  issuer,
+		"oidc_subject": subject,
+	})
+	if err != database.ErrNoUser {
+		return user, err
+	}
+
+	email, _ := claims["email"].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	emailVerified, _ := claims["email_verified"].(bool)
+	if !emailVerified {
+		email = ""
+	}
+
+	if conf.LinkByEmail && email != "" {
+		user, err = database.User(bson.M{
+			"email": email,
+		})
+		if err == nil {
+			// an owner is only linked if it's confirmed in config,
+			// and an existing link is never replaced
+			if user.OIDCSubject != "" ||
+				(user.Role == structure.RoleOwner && !conf.LinkOwnerByEmail) {
+				return structure.User{}, errOIDCLinkRefused
+			}
+
+			err = database.UpdateUser(
+				bson.M{
+					"_id": user.ID,
+					"oidc_subject": bson.M{
+						"$exists": false,
+					},
+				},
+				structure.User{
+					OIDCIssuer:  issuer,
+					OIDCSubject: subject,
+				},
+			)
+			if err != nil {
+				if err == database.ErrNoUser {
+					// linked by another login meanwhile
+					return structure.User{}, errOIDCLinkRefused
+				}
+				return structure.User{}, err
+			}
+
+			auditAs(c, user.ID, structure.AuditUserOIDCLink, user.ID.Hex(),
+				&structure.User{},
+				&structure.User{OIDCIssuer: issuer, OIDCSubject: subject},
+			)
+			return user, nil
+		}
+		if err != database.ErrNoUser {
+			return user, err
+		}
+	}
+
+	if !conf.AutoCreate {
+		return structure.User{}, errOIDCNoUser
+	}
+
+	username, _ := claims["preferred_username"].(string)
+	if strings.TrimSpace(username) == "" {
+		username = strings.Split(email, "@")[0]
+	}
+	username, err = availableUsername(username)
+	if err != nil {
+		return structure.User{}, err
+	}
+
+	if email != "" {
+		// don't take the email of another user
+		users, err := database.Users(bson.M{
+			"email": email,
+		})
+		if err != nil {
+			return structure.User{}, err
+		}
+		if len(users) > 0 {
+			email = ""
+		}
+	}
+
+	role := conf.DefaultRole
+	if !structure.IsValidRole(role) {
+		role = structure.RoleContributor
+	}
+
+	user = structure.User{
+		Username:    username,
+		Email:       email,
+		Role:        role,
+		Disabled:    new(bool),
+		OIDCIssuer:  issuer,
+		OIDCSubject: subject,
+	}
+	err = database.InsertUser(&user)
+
+	return user, err
+}
+
+// availableUsername returns the username, or the username
+// with a number suffix if it has been taken
+func availableUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		username = "user"
+	}
+
+	for i := 1; ; i++ {
+		name := username
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", username, i)
+		}
+
+		users, err := database.Users(bson.M{
+			"username": name,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(users) == 0 {
+			return name, nil
+		}
+	}
+}
+
+// GetOIDCLogin handles the GET request for url path "/admin/oidc/login",
+// returns the url of the provider's authorization endpoint, the client
+// redirects the user to it and posts the code and state given back by
+// the provider to "/admin/oidc/callback"
+func GetOIDCLogin(c *gin.Context) {
+	if !oidcEnabled() {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "OIDC login isn't enabled",
+		})
+		return
+	}
+
+	provider, err := oidcProviderMetadata()
+	if err != nil {
+		logger.Error("oidc discovery: " + err.Error())
+		c.JSON(http.StatusBadGateway, errRes{
+			Status:  http.StatusBadGateway,
+			Message: "OIDC provider is unavailable",
+		})
+		return
+	}
+
+	// state, nonce and pkce code verifier
+	var values [3]string
+	for i := range values {
+		values[i], err = randomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	state := structure.OIDCState{
+		StateHash:    hashToken(values[0]),
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		CreatedAt:    time.Now(),
+	}
+	state.ExpiresAt = state.CreatedAt.Add(time.Second * oidcStateExp)
+
+	err = database.InsertOIDCState(&state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	conf := configer.Config.OIDC
+	scopes := conf.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", conf.ClientID)
+	query.Set("redirect_uri", conf.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", values[0])
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	authURL := provider.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + query.Encode()
+	} else {
+		authURL += "?" + query.Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             values[0],
+		"expires_in":        oidcStateExp,
+	})
+}
+
+// PostOIDCCallback handles the POST request for url path
+// "/admin/oidc/callback", exchanges the authorization code
+// for the id token and logs in the user linked to it
+func PostOIDCCallback(c *gin.Context) {
+	if !oidcEnabled() {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "OIDC login isn't enabled",
+		})
+		return
+	}
+
+	callback := new(structure.OIDCCallback)
+	if err := c.ShouldBindJSON(callback); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	// the state can only be used once
+	state, err := database.UseOIDCState(bson.M{
+		"state_hash": hashToken(callback.State),
+	})
+	if err != nil && err != database.ErrNoOIDCState {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if err == database.ErrNoOIDCState || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid state",
+		})
+		return
+	}
+
+	provider, err := oidcProviderMetadata()
+	if err != nil {
+		logger.Error("oidc discovery: " + err.Error())
+		c.JSON(http.StatusBadGateway, errRes{
+			Status:  http.StatusBadGateway,
+			Message: "OIDC provider is unavailable",
+		})
+		return
+	}
+
+	idToken, err := exchangeOIDCCode(provider, callback.Code, state.CodeVerifier)
+	if err != nil {
+		logger.Warn("oidc code exchange: " + err.Error())
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "OIDC login failed",
+		})
+		return
+	}
+
+	claims, err := verifyIDToken(provider, idToken, state.Nonce)
+	if err != nil {
+		logger.Warn("oidc id token: " + err.Error())
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "OIDC login failed",
+		})
+		return
+	}
+
+	user, err := oidcUser(c, provider.Issuer, claims)
+	if err != nil {
+		if err == errOIDCNoUser {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "No user is linked to the identity",
+			})
+			return
+		}
+		if err == errOIDCLinkRefused {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Identity can't be linked to the user with the email",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		// the identity provider is only the first factor,
+		// the second step of login is still required
+		respondLoginChallenge(c, *user.ID)
+		return
+	}
+
+	res, err := startSession(c, *user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	auditAs(c, user.ID, structure.AuditLogin, user.ID.Hex(), nil, nil)
+
+	c.JSON(http.StatusOK, res)
+}
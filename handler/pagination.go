@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageCursor the position after which the next page starts,
+// it's encoded as an opaque string for the client, Time or Value
+// is the sort key of the last document if it's not sorted by "_id"
+type pageCursor struct {
+	Sort  string     `json:"s"`
+	ID    string     `json:"id"`
+	Time  *time.Time `json:"t,omitempty"`
+	Value *string    `json:"v,omitempty"`
+}
+
+// pagination the page requested by query parameters "limit" and
+// either "offset" or "cursor", the documents are sorted by sort
+type pagination struct {
+	limit     int
+	offset    int
+	useOffset bool
+	after     *pageCursor
+	sort      string
+}
+
+// encodeCursor encodes the cursor as an opaque string
+func encodeCursor(cursor pageCursor) string {
+	bytes, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// decodeCursor decodes the opaque cursor string
+func decodeCursor(s string) (*pageCursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := new(pageCursor)
+	err = json.Unmarshal(bytes, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if !bson.IsObjectIdHex(cursor.ID) {
+		return nil, fmt.Errorf("invalid cursor id %q", cursor.ID)
+	}
+
+	return cursor, nil
+}
+
+// validFor reports whether the cursor has the sort key of the field,
+// "created_at" and "updated_at" need a time, "_id" needs no key and
+// the other fields need a value
+func (cursor *pageCursor) validFor(field string) bool {
+	switch field {
+	case "_id":
+		return cursor.Time == nil && cursor.Value == nil
+	case "created_at", "updated_at":
+		return cursor.Time != nil && cursor.Value == nil
+	}
+
+	return cursor.Time == nil && cursor.Value != nil
+}
+
+// parsePagination parses the page from query parameters, documents are
+// sorted by the field of sort ascending, or descending if it's prefixed
+// with "-", responds with an error if the parameters are invalid
+func parsePagination(c *gin.Context, sort string) (*pagination, bool) {
+	p := &pagination{
+		limit: defaultPageSize,
+		sort:  sort,
+	}
+
+	var err error
+	if c.Query("limit") != "" {
+		p.limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || p.limit <= 0 || p.limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("Limit must be between 1 and %d", maxPageSize),
+			})
+			return nil, false
+		}
+	}
+
+	if c.Query("offset") != "" && c.Query("cursor") != "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Offset and cursor can't be used together",
+		})
+		return nil, false
+	}
+
+	if c.Query("offset") != "" {
+		p.useOffset = true
+		p.offset, err = strconv.Atoi(c.Query("offset"))
+		if err != nil || p.offset < 0 {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid offset",
+			})
+			return nil, false
+		}
+	}
+
+	if c.Query("cursor") != "" {
+		p.after, err = decodeCursor(c.Query("cursor"))
+		if err != nil || p.after.Sort != sort || !p.after.validFor(p.sortField()) {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid cursor",
+			})
+			return nil, false
+		}
+	}
+
+	return p, true
+}
+
+// sortField returns the field the documents are sorted by
+func (p *pagination) sortField() string {
+	return strings.TrimPrefix(p.sort, "-")
+}
+
+// sortFields returns the sort of the documents, ties are broken
+// by "_id" in the same order so that cursors are stable
+func (p *pagination) sortFields() []string {
+	if p.sortField() == "_id" {
+		return []string{p.sort}
+	}
+
+	if strings.HasPrefix(p.sort, "-") {
+		return []string{p.sort, "-_id"}
+	}
+	return []string{p.sort, "_id"}
+}
+
+// filter returns the filter of documents in the page,
+// the documents after the cursor in cursor mode
+func (p *pagination) filter(filter bson.M) bson.M {
+	if p.after == nil {
+		return filter
+	}
+
+	operator := "$gt"
+	if strings.HasPrefix(p.sort, "-") {
+		operator = "$lt"
+	}
+	id := bson.ObjectIdHex(p.after.ID)
+
+	after := bson.M{
+		"_id": bson.M{
+			operator: id,
+		},
+	}
+
+	if field := p.sortField(); field != "_id" {
+		var value interface{}
+		if p.after.Time != nil {
+			value = *p.after.Time
+		} else {
+			value = *p.after.Value
+		}
+
+		// documents with a greater (or less) sort key, or with the
+		// same sort key and a greater (or less) id
+		after = bson.M{
+			"$or": []bson.M{
+				{field: bson.M{operator: value}},
+				{field: value, "_id": bson.M{operator: id}},
+			},
+		}
+	}
+
+	return andFilter(filter, after)
+}
+
+// andFilter combines the filters, the filters may have their own "$or"
+// or the same field, so they are combined with "$and" instead of adding
+// the keys, empty filters are ignored
+func andFilter(filters ...bson.M) bson.M {
+	var nonEmpty []bson.M
+	for _, filter := range filters {
+		if len(filter) > 0 {
+			nonEmpty = append(nonEmpty, filter)
+		}
+	}
+
+	switch len(nonEmpty) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return nonEmpty[0]
+	}
+
+	return bson.M{
+		"$and": nonEmpty,
+	}
+}
+
+// pageLink returns the url of the page with the query parameters
+func pageLink(c *gin.Context, params map[string]string) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Del("offset")
+	query.Del("cursor")
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.RequestURI()
+}
+
+// setPageHeaders sets header "X-Total-Count" with the amount of all
+// documents, and header "Link" with the links of first, previous, next
+// and last page, last is the cursor of the last document in this page,
+// which is nil if the page is empty
+func setPageHeaders(c *gin.Context, p *pagination, total int, count int, last *pageCursor) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+
+	limit := strconv.Itoa(p.limit)
+	links := []string{
+		fmt.Sprintf(`<%s>; rel="first"`, pageLink(c, map[string]string{
+			"limit": limit,
+		})),
+	}
+
+	if p.useOffset {
+		if p.offset > 0 {
+			prev := p.offset - p.limit
+			if prev < 0 {
+				prev = 0
+			}
+			links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageLink(c, map[string]string{
+				"limit":  limit,
+				"offset": strconv.Itoa(prev),
+			})))
+		}
+
+		if p.offset+count < total {
+			links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageLink(c, map[string]string{
+				"limit":  limit,
+				"offset": strconv.Itoa(p.offset + p.limit),
+			})))
+		}
+
+		if total > 0 {
+			links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageLink(c, map[string]string{
+				"limit":  limit,
+				"offset": strconv.Itoa((total - 1) / p.limit * p.limit),
+			})))
+		}
+	} else if count == p.limit && last != nil {
+		// a cursor only goes forward
+		cursor := encodeCursor(*last)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageLink(c, map[string]string{
+			"limit":  limit,
+			"cursor": cursor,
+		})))
+		c.Header("X-Next-Cursor", cursor)
+	}
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// postCursor returns the cursor of the last post,
+// nil if there is no post
+func postCursor(p *pagination, posts []structure.Post) *pageCursor {
+	if len(posts) == 0 || posts[len(posts)-1].ID == nil {
+		return nil
+	}
+	post := posts[len(posts)-1]
+
+	cursor := &pageCursor{
+		Sort: p.sort,
+		ID:   post.ID.Hex(),
+	}
+	switch p.sortField() {
+	case "created_at":
+		cursor.Time = &post.CreatedAt
+	case "updated_at":
+		cursor.Time = &post.UpdatedAt
+	case "title":
+		cursor.Value = &post.Title
+	}
+
+	return cursor
+}
+
+// categoryCursor returns the cursor of the last category,
+// nil if there is no category
+func categoryCursor(p *pagination, categories []structure.Category) *pageCursor {
+	if len(categories) == 0 || categories[len(categories)-1].ID == nil {
+		return nil
+	}
+
+	return &pageCursor{
+		Sort: p.sort,
+		ID:   categories[len(categories)-1].ID.Hex(),
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+)
+
+const testCursorID = "5b0cfcb8a6b1a3c4d7e8f901"
+
+// testContext returns a context of GET request with the query
+func testContext(query url.Values) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/posts?"+query.Encode(), nil)
+
+	return c, w
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 8, 30, 0, 0, time.UTC)
+	title := "Hello, 世界"
+
+	tests := []struct {
+		name   string
+		cursor pageCursor
+	}{
+		{"id", pageCursor{Sort: "-_id", ID: testCursorID}},
+		{"time", pageCursor{Sort: "-created_at", ID: testCursorID, Time: &createdAt}},
+		{"value", pageCursor{Sort: "title", ID: testCursorID, Value: &title}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := decodeCursor(encodeCursor(tt.cursor))
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if decoded.Sort != tt.cursor.Sort || decoded.ID != tt.cursor.ID {
+				t.Errorf("decodeCursor() = %+v, want %+v", decoded, tt.cursor)
+			}
+			if (decoded.Time == nil) != (tt.cursor.Time == nil) ||
+				decoded.Time != nil && !decoded.Time.Equal(*tt.cursor.Time) {
+				t.Errorf("decodeCursor() time = %v, want %v", decoded.Time, tt.cursor.Time)
+			}
+			if !reflect.DeepEqual(decoded.Value, tt.cursor.Value) {
+				t.Errorf("decodeCursor() value = %v, want %v", decoded.Value, tt.cursor.Value)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedCursor(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"_id","id":"` + testCursorID + `"}`))},
+		{"not json", encode("cursor")},
+		{"wrong type", encode(`{"s":"_id","id":1}`)},
+		{"missing id", encode(`{"s":"_id"}`)},
+		{"invalid id", encode(`{"s":"_id","id":"abc"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q) = %+v, want an error", tt.cursor, cursor)
+			}
+		})
+	}
+}
+
+func TestParsePaginationCursor(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 8, 30, 0, 0, time.UTC)
+	title := "title"
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		valid  bool
+	}{
+		{"id", "-_id", encodeCursor(pageCursor{Sort: "-_id", ID: testCursorID}), true},
+		{"time", "-created_at", encodeCursor(pageCursor{Sort: "-created_at", ID: testCursorID, Time: &createdAt}), true},
+		{"value", "title", encodeCursor(pageCursor{Sort: "title", ID: testCursorID, Value: &title}), true},
+		{"malformed", "-_id", "not a cursor!", false},
+		{"other sort", "-created_at", encodeCursor(pageCursor{Sort: "created_at", ID: testCursorID, Time: &createdAt}), false},
+		{"time missing", "-created_at", encodeCursor(pageCursor{Sort: "-created_at", ID: testCursorID}), false},
+		{"value missing", "title", encodeCursor(pageCursor{Sort: "title", ID: testCursorID}), false},
+		{"value for time", "-created_at", encodeCursor(pageCursor{Sort: "-created_at", ID: testCursorID, Value: &title}), false},
+		{"time for value", "title", encodeCursor(pageCursor{Sort: "title", ID: testCursorID, Time: &createdAt}), false},
+		{"key for id", "-_id", encodeCursor(pageCursor{Sort: "-_id", ID: testCursorID, Value: &title}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(url.Values{"cursor": {tt.cursor}})
+
+			p, ok := parsePagination(c, tt.sort)
+			if ok != tt.valid {
+				t.Fatalf("parsePagination() ok = %v, want %v", ok, tt.valid)
+			}
+			if !ok {
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+				}
+				return
+			}
+
+			// a valid cursor must never make filter panic
+			p.filter(bson.M{})
+		})
+	}
+}
+
+func TestPaginationFilter(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 8, 30, 0, 0, time.UTC)
+	title := "title"
+	id := bson.ObjectIdHex(testCursorID)
+	base := bson.M{"is_publish": true}
+
+	tests := []struct {
+		name   string
+		page   pagination
+		filter bson.M
+	}{
+		{
+			"no cursor",
+			pagination{sort: "-_id"},
+			base,
+		},
+		{
+			"id descending",
+			pagination{sort: "-_id", after: &pageCursor{Sort: "-_id", ID: testCursorID}},
+			bson.M{"$and": []bson.M{base, {"_id": bson.M{"$lt": id}}}},
+		},
+		{
+			"time descending",
+			pagination{sort: "-created_at", after: &pageCursor{Sort: "-created_at", ID: testCursorID, Time: &createdAt}},
+			bson.M{"$and": []bson.M{base, {"$or": []bson.M{
+				{"created_at": bson.M{"$lt": createdAt}},
+				{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+			}}}},
+		},
+		{
+			"value ascending",
+			pagination{sort: "title", after: &pageCursor{Sort: "title", ID: testCursorID, Value: &title}},
+			bson.M{"$and": []bson.M{base, {"$or": []bson.M{
+				{"title": bson.M{"$gt": title}},
+				{"title": title, "_id": bson.M{"$gt": id}},
+			}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.page.filter(base)
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("filter() = %v, want %v", filter, tt.filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/globalsign/mgo/bson"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	passwordMaxBytes         = 72 // bcrypt only uses the first 72 bytes
+)
+
+var (
+	dummyPasswordHash []byte
+	dummyPasswordOnce sync.Once
+)
+
+// PasswordCost returns the bcrypt cost given in configuration,
+// bcrypt.DefaultCost returned if it isn't given or is invalid
+func PasswordCost() int {
+	cost := configer.Config.BcryptCost
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+
+	return cost
+}
+
+// HashPassword hashes the password with the configured bcrypt cost
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), PasswordCost())
+}
+
+// CheckPassword checks if the password of the user
+// satisfies the password policy given in configuration
+func CheckPassword(username string, password string) error {
+	minLength := configer.Config.PasswordMinLength
+	if minLength <= 0 {
+		minLength = defaultPasswordMinLength
+	}
+
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must have at least %d characters", minLength)
+	}
+
+	if len(password) > passwordMaxBytes {
+		return fmt.Errorf("password must not be longer than %d bytes", passwordMaxBytes)
+	}
+
+	lower := strings.ToLower(password)
+
+	check := configer.Config.PasswordCheckCommon
+	if (check == nil || *check) && commonPasswords[lower] {
+		return errors.New("password is too common")
+	}
+
+	check = configer.Config.PasswordCheckUsername
+	username = strings.ToLower(strings.TrimSpace(username))
+	if (check == nil || *check) && username != "" && strings.Contains(lower, username) {
+		return errors.New("password must not contain the username")
+	}
+
+	return nil
+}
+
+// needsRehash reports whether the password hash was
+// made with a bcrypt cost other than the configured one
+func needsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost != PasswordCost()
+}
+
+// rehashPassword hashes the password of the user again
+// with the configured bcrypt cost
+func rehashPassword(userID bson.ObjectId, password string) error {
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return database.UpdateUser(
+		bson.M{
+			"_id": userID,
+		},
+		structure.User{
+			PasswordHash: passwordHash,
+		},
+	)
+}
+
+// dummyHash returns the hash compared with when the user doesn't
+// exist, it's made with the configured cost so that the response
+// time is the same as comparing with a real hash
+func dummyHash() []byte {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = HashPassword("dummy password")
+	})
+
+	return dummyPasswordHash
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      string // a part of the error message, empty if it's accepted
+	}{
+		{"strong", "alice", "correct horse battery", ""},
+		{"too short", "alice", "x7#kQ2", "at least 8 characters"},
+		{"common", "alice", "password1", "too common"},
+		{"common in other case", "alice", "IloveYou1", "too common"},
+		{"common keyboard walk", "alice", "qwertyuiop", "too common"},
+		{"contains username", "alice", "alice-in-wonderland", "username"},
+		{"too long", "alice", strings.Repeat("a", passwordMaxBytes+1), "longer than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPassword(tt.username, tt.password)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("CheckPassword(%q) error = %v, want nil", tt.password, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CheckPassword(%q) error = %v, want %q", tt.password, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordsLength(t *testing.T) {
+	// shorter passwords are rejected by the length,
+	// so they are useless in the list
+	for password := range commonPasswords {
+		if len(password) < defaultPasswordMinLength {
+			t.Errorf("common password %q is shorter than %d", password, defaultPasswordMinLength)
+		}
+		if password != strings.ToLower(password) {
+			t.Errorf("common password %q isn't in lower case", password)
+		}
+	}
+}
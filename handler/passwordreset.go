@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+	"github.com/jaaaaason/hmblog/mailer"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const passwordResetSubject = "HMBlog password reset"
+
+// passwordResetLink returns the link sent to the user,
+// the token is added to the url as query parameter "token"
+func passwordResetLink(token string) (string, error) {
+	u, err := url.Parse(configer.Config.PasswordResetURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// sendPasswordReset creates a password reset of the user and
+// mails the link to the user, the former resets are replaced,
+// nothing is sent if a link was sent within passwordResetInterval
+func sendPasswordReset(user structure.User) error {
+	err := database.SetPasswordResetSent(*user.ID,
+		time.Now().Add(-time.Second*passwordResetInterval))
+	if err != nil {
+		if err == database.ErrPasswordResetSent {
+			return nil
+		}
+
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	link, err := passwordResetLink(token)
+	if err != nil {
+		return err
+	}
+
+	err = database.RemovePasswordResets(bson.M{
+		"user_id": user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	reset := structure.PasswordReset{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+	}
+	reset.ExpiresAt = reset.CreatedAt.Add(time.Second * passwordResetExp)
+
+	err = database.InsertPasswordReset(&reset)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(
+		user.Email,
+		passwordResetSubject,
+		"Hi "+user.Username+",\n\n"+
+			"Someone requested to reset the password of your HMBlog account.\n"+
+			"Open the link below to set a new password, it expires in 1 hour:\n\n"+
+			link+"\n\n"+
+			"If you didn't request it, just ignore this mail.\n",
+	)
+}
+
+// PostPasswordReset handles the POST request for url path
+// "/admin/password-reset", a reset link is mailed to the user
+// with the email, the response is the same whether the user
+// exists or not, so the email of users isn't revealed
+func PostPasswordReset(c *gin.Context) {
+	request := new(structure.PasswordResetRequest)
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	user, err := database.User(bson.M{
+		"email": strings.ToLower(strings.TrimSpace(request.Email)),
+	})
+	if err != nil && err != database.ErrNoUser {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if err == nil && !user.IsDisabled() {
+		// send the mail in background, so the response
+		// time doesn't reveal whether the user exists
+		go func() {
+			if err := sendPasswordReset(user); err != nil {
+				logger.Error("failed to send password reset mail: " + err.Error())
+			}
+		}()
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "A password reset link will be sent if the email is registered",
+	})
+}
+
+// PostPasswordResetConfirm handles the POST request for url path
+// "/admin/password-reset/confirm", sets the new password with the
+// reset token and signs out all sessions of the user
+func PostPasswordResetConfirm(c *gin.Context) {
+	confirm := new(structure.PasswordResetConfirm)
+	if err := c.ShouldBindJSON(confirm); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	reset, err := database.PasswordReset(bson.M{
+		"token_hash": hashToken(confirm.Token),
+	})
+	if err != nil {
+		if err == database.ErrNoPasswordReset {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No password reset found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the TTL index removes expired documents
+	// only periodically, so check it here
+	if time.Now().After(reset.ExpiresAt) {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No password reset found",
+		})
+		return
+	}
+
+	originUser, err := database.User(bson.M{
+		"_id": reset.UserID,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if originUser.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return
+	}
+
+	if err = CheckPassword(originUser.Username, confirm.Password); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Weak password, " + err.Error(),
+		})
+		return
+	}
+
+	// the reset token can only be used once, consume it before
+	// setting the password so concurrent requests can't both pass
+	_, err = database.UsePasswordReset(bson.M{
+		"token_hash": reset.TokenHash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		if err == database.ErrNoPasswordReset {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No password reset found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	var user structure.User
+	user.MustChangePassword = new(bool)
+	user.PasswordHash, err = HashPassword(confirm.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.UpdateUser(
+		bson.M{
+			"_id": reset.UserID,
+		},
+		user,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the user proved the ownership of the mailbox with the token
+	auditAs(c, reset.UserID, structure.AuditUserPasswordReset, reset.UserID.Hex(),
+		&structure.User{PasswordHash: originUser.PasswordHash},
+		&structure.User{PasswordHash: user.PasswordHash},
+	)
+
+	// sign out all sessions and unlock the login of the user
+	err = RevokeUserTokens(*reset.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.RemoveLoginFailures(bson.M{
+		"kind":  structure.LoginFailureUsername,
+		"value": originUser.Username,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// the permissions of blog user
+const (
+	PermPostCreate     = "posts:create"      // create and edit own unpublished posts
+	PermPostPublish    = "posts:publish"     // publish, edit and delete own posts
+	PermPostEditOthers = "posts:edit_others" // read, publish, edit and delete others' posts
+	PermCategoryManage = "categories:manage" // create, edit and delete categories
+	PermUserManage     = "users:manage"      // manage users and their roles
+)
+
+// rolePermissions the permissions granted to each role
+var rolePermissions = map[string][]string{
+	structure.RoleOwner: []string{
+		PermPostCreate,
+		PermPostPublish,
+		PermPostEditOthers,
+		PermCategoryManage,
+		PermUserManage,
+	},
+	structure.RoleEditor: []string{
+		PermPostCreate,
+		PermPostPublish,
+		PermPostEditOthers,
+	},
+	structure.RoleAuthor: []string{
+		PermPostCreate,
+		PermPostPublish,
+	},
+	structure.RoleContributor: []string{
+		PermPostCreate,
+	},
+}
+
+// hasPermission reports whether the role is granted the permission
+func hasPermission(role string, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PermissionMiddleware the middleware for checking if current
+// user has the permission, it must be used after JWTMiddleware
+func PermissionMiddleware(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(c.GetString("role"), perm) {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Permission denied",
+			})
+
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// visiblePostFilter returns the filter of posts that are visible
+// to the user in admin, users who can edit others' posts see all posts,
+// the others see published posts and their own unpublished posts
+func visiblePostFilter(userID bson.ObjectId, role string, filter bson.M) bson.M {
+	if hasPermission(role, PermPostEditOthers) {
+		return filter
+	}
+
+	published := bson.M{
+		"is_publish": true,
+	}
+	unpublished := bson.M{
+		"is_publish": false,
+		"user_id":    userID,
+	}
+	for k, v := range filter {
+		published[k] = v
+		unpublished[k] = v
+	}
+
+	return bson.M{
+		"$or": []bson.M{
+			published,
+			unpublished,
+		},
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/globalsign/mgo/bson"
 	"github.com/jaaaaason/hmblog/database"
 	"github.com/jaaaaason/hmblog/structure"
@@ -14,9 +15,29 @@ import (
 
 // GetPosts handles the GET request of url path "/posts"
 func GetPosts(c *gin.Context) {
-	posts, err := database.Posts(bson.M{
+	query, ok := parsePostFilter(c, false)
+	if !ok {
+		return
+	}
+	filter := andFilter(bson.M{
 		"is_publish": true,
-	})
+	}, query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -26,51 +47,20 @@ func GetPosts(c *gin.Context) {
 	}
 
 	for i := range posts {
-		if posts[i].CategoryID != nil {
-			// retrieve post's category
-			categories, err := database.Categories(bson.M{
-				"_id": posts[i].CategoryID,
+		if err := postRelations(&posts[i], publishedFilter); err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
 			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
-			}
-			if len(categories) > 0 {
-				categories[0].PostCount, err = database.PostCount(bson.M{
-					"category_id": categories[0].ID,
-					"is_publish":  true,
-				})
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, errRes{
-						Status:  http.StatusInternalServerError,
-						Message: "Internal server error",
-					})
-					return
-				}
-
-				posts[i].Category = &categories[0]
-			}
+			return
 		}
+	}
 
-		if posts[i].UserID != nil {
-			// retrieve post's owner
-			user, err := database.User(bson.M{
-				"_id": posts[i].UserID,
-			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
-			}
-			posts[i].User = &user
-		}
+	if !renderPosts(c, posts) {
+		return
 	}
 
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
 	c.JSON(http.StatusOK, posts)
 }
 
@@ -107,39 +97,114 @@ func GetPost(c *gin.Context) {
 		return
 	}
 
-	if posts[0].CategoryID != nil {
+	respondPost(c, posts[0])
+}
+
+// publishedFilter returns the filter of published posts
+// which also match the filter
+func publishedFilter(filter bson.M) bson.M {
+	filter["is_publish"] = true
+	return filter
+}
+
+// visibleFilter returns a function which returns the filter of posts
+// visible to the user which also match the filter
+func visibleFilter(userID bson.ObjectId, role string) func(bson.M) bson.M {
+	return func(filter bson.M) bson.M {
+		return visiblePostFilter(userID, role, filter)
+	}
+}
+
+// postRelations retrieves the category and owner of the post,
+// countFilter returns the filter of posts counted in the category,
+// the owner is kept if it's already set
+func postRelations(post *structure.Post, countFilter func(bson.M) bson.M) error {
+	if post.CategoryID != nil {
 		// retrieve post's category
 		categories, err := database.Categories(bson.M{
-			"_id": posts[0].CategoryID,
+			"_id": post.CategoryID,
 		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, errRes{
-				Status:  http.StatusInternalServerError,
-				Message: "Internal server error",
-			})
-			return
+			return err
 		}
 		if len(categories) > 0 {
-			categories[0].PostCount, err = database.PostCount(bson.M{
+			categories[0].PostCount, err = database.PostCount(countFilter(bson.M{
 				"category_id": categories[0].ID,
-				"is_publish":  true,
-			})
+			}))
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
+				return err
 			}
 
-			posts[0].Category = &categories[0]
+			post.Category = &categories[0]
 		}
 	}
 
-	if posts[0].UserID != nil {
+	if post.UserID != nil && post.User == nil {
 		// retrieve post's owner
 		user, err := database.User(bson.M{
-			"_id": posts[0].UserID,
+			"_id": post.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		post.User = user.Author()
+	}
+
+	return nil
+}
+
+// respondPost responds with the published post,
+// including its category and owner
+func respondPost(c *gin.Context, post structure.Post) {
+	if err := postRelations(&post, publishedFilter); err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if !renderPost(c, &post) {
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// GetPostBySlug handles the GET request of url path
+// "/post-slugs/:slug", a previous slug of the post is
+// redirected to the current one
+func GetPostBySlug(c *gin.Context) {
+	posts, err := database.Posts(bson.M{
+		"slug":       c.Param("slug"),
+		"is_publish": true,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if len(posts) > 0 {
+		respondPost(c, posts[0])
+		return
+	}
+
+	history, err := database.SlugHistory("posts", c.Param("slug"))
+	if err != nil && err != database.ErrNoSlugHistory {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if history != nil {
+		posts, err = database.Posts(bson.M{
+			"_id":        history.TargetID,
+			"is_publish": true,
 		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, errRes{
@@ -148,10 +213,19 @@ func GetPost(c *gin.Context) {
 			})
 			return
 		}
-		posts[0].User = &user
+
+		// not a permanent redirect, the old slug
+		// may be taken by another one later
+		if len(posts) > 0 && posts[0].Slug != "" {
+			c.Redirect(http.StatusFound, "/post-slugs/"+posts[0].Slug)
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, posts[0])
+	c.JSON(http.StatusNotFound, errRes{
+		Status:  http.StatusNotFound,
+		Message: "No post found",
+	})
 }
 
 // GetAdminPosts handles the GET request of url path "/admin/posts"
@@ -165,18 +239,30 @@ func GetAdminPosts(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
-	posts, err := database.Posts(bson.M{
-		"$or": []bson.M{
-			bson.M{
-				"is_publish": true,
-			},
-			bson.M{
-				"is_publish": false,
-				"user_id":    userID,
-			},
-		},
-	})
+	query, ok := parsePostFilter(c, true)
+	if !ok {
+		return
+	}
+	// combined with "$and", the query may contain "is_publish"
+	filter := andFilter(visiblePostFilter(userID, role, nil), query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -186,60 +272,20 @@ func GetAdminPosts(c *gin.Context) {
 	}
 
 	for i := range posts {
-		if posts[i].CategoryID != nil {
-			// retrieve post's category
-			categories, err := database.Categories(bson.M{
-				"_id": posts[i].CategoryID,
+		if err := postRelations(&posts[i], visibleFilter(userID, role)); err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
 			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
-			}
-			if len(categories) > 0 {
-				categories[0].PostCount, err = database.PostCount(bson.M{
-					"$or": []bson.M{
-						bson.M{
-							"category_id": categories[0].ID,
-							"is_publish":  true,
-						},
-						bson.M{
-							"category_id": categories[0].ID,
-							"is_publish":  false,
-							"user_id":     userID,
-						},
-					},
-				})
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, errRes{
-						Status:  http.StatusInternalServerError,
-						Message: "Internal server error",
-					})
-					return
-				}
-
-				posts[i].Category = &categories[0]
-			}
+			return
 		}
+	}
 
-		if posts[i].UserID != nil {
-			// retrieve post's owner
-			user, err := database.User(bson.M{
-				"_id": posts[i].UserID,
-			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
-			}
-			posts[i].User = &user
-		}
+	if !renderPosts(c, posts) {
+		return
 	}
 
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
 	c.JSON(http.StatusOK, posts)
 }
 
@@ -264,20 +310,11 @@ func GetAdminPost(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
-	posts, err := database.Posts(bson.M{
-		"$or": []bson.M{
-			bson.M{
-				"_id":        oid,
-				"is_publish": true,
-			},
-			bson.M{
-				"_id":        oid,
-				"is_publish": false,
-				"user_id":    userID,
-			},
-		},
-	})
+	posts, err := database.Posts(visiblePostFilter(userID, role, bson.M{
+		"_id": oid,
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -294,57 +331,16 @@ func GetAdminPost(c *gin.Context) {
 		return
 	}
 
-	if posts[0].CategoryID != nil {
-		// retrieve post's category
-		categories, err := database.Categories(bson.M{
-			"_id": posts[0].CategoryID,
+	if err := postRelations(&posts[0], visibleFilter(userID, role)); err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, errRes{
-				Status:  http.StatusInternalServerError,
-				Message: "Internal server error",
-			})
-			return
-		}
-		if len(categories) > 0 {
-			categories[0].PostCount, err = database.PostCount(bson.M{
-				"$or": []bson.M{
-					bson.M{
-						"category_id": categories[0].ID,
-						"is_publish":  true,
-					},
-					bson.M{
-						"category_id": categories[0].ID,
-						"is_publish":  false,
-						"user_id":     userID,
-					},
-				},
-			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, errRes{
-					Status:  http.StatusInternalServerError,
-					Message: "Internal server error",
-				})
-				return
-			}
-
-			posts[0].Category = &categories[0]
-		}
+		return
 	}
 
-	if posts[0].UserID != nil {
-		// retrieve post's owner
-		user, err := database.User(bson.M{
-			"_id": posts[0].UserID,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, errRes{
-				Status:  http.StatusInternalServerError,
-				Message: "Internal server error",
-			})
-			return
-		}
-		posts[0].User = &user
+	if !renderPost(c, &posts[0]) {
+		return
 	}
 
 	c.JSON(http.StatusOK, posts[0])
@@ -386,11 +382,38 @@ func GetCategoryPosts(c *gin.Context) {
 		"category_id": oid,
 		"is_publish":  true,
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
 
-	posts, err := database.Posts(bson.M{
+	query, ok := parsePostFilter(c, false)
+	if !ok {
+		return
+	}
+	filter := andFilter(bson.M{
 		"category_id": oid,
 		"is_publish":  true,
-	})
+	}, query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -404,13 +427,18 @@ func GetCategoryPosts(c *gin.Context) {
 
 		if posts[i].UserID != nil {
 			// retrieve user
-			posts[i].User = new(structure.User)
-			*posts[i].User, _ = database.User(bson.M{
+			owner, _ := database.User(bson.M{
 				"_id": posts[i].UserID,
 			})
+			posts[i].User = owner.Author()
 		}
 	}
 
+	if !renderPosts(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
 	c.JSON(http.StatusOK, posts)
 }
 
@@ -437,6 +465,7 @@ func GetAdminCategoryPosts(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
 	categories, err := database.Categories(bson.M{
 		"_id": oid,
@@ -457,33 +486,40 @@ func GetAdminCategoryPosts(c *gin.Context) {
 		return
 	}
 
-	categories[0].PostCount, err = database.PostCount(bson.M{
-		"$or": []bson.M{
-			bson.M{
-				"category_id": oid,
-				"is_publish":  true,
-			},
-			bson.M{
-				"category_id": oid,
-				"is_publish":  false,
-				"user_id":     userID,
-			},
-		},
-	})
+	categories[0].PostCount, err = database.PostCount(visiblePostFilter(userID, role, bson.M{
+		"category_id": oid,
+	}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
 
-	posts, err := database.Posts(bson.M{
-		"$or": []bson.M{
-			bson.M{
-				"category_id": oid,
-				"is_publish":  true,
-			},
-			bson.M{
-				"category_id": oid,
-				"is_publish":  false,
-				"user_id":     userID,
-			},
-		},
-	})
+	query, ok := parsePostFilter(c, true)
+	if !ok {
+		return
+	}
+	filter := andFilter(visiblePostFilter(userID, role, bson.M{
+		"category_id": oid,
+	}), query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -496,13 +532,18 @@ func GetAdminCategoryPosts(c *gin.Context) {
 		posts[i].Category = &categories[0]
 
 		if posts[i].UserID != nil {
-			posts[i].User = new(structure.User)
-			*posts[i].User, _ = database.User(bson.M{
+			owner, _ := database.User(bson.M{
 				"_id": posts[i].UserID,
 			})
+			posts[i].User = owner.Author()
 		}
 	}
 
+	if !renderPosts(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
 	c.JSON(http.StatusOK, posts)
 }
 
@@ -519,6 +560,8 @@ func PostPost(c *gin.Context) {
 
 	// trim space
 	post.Title = strings.TrimSpace(post.Title)
+	post.Excerpt = strings.TrimSpace(post.Excerpt)
+	post.Tags = normalizeTags(post.Tags)
 	if post.Title == "" {
 		// empty category name
 		c.JSON(http.StatusBadRequest, errRes{
@@ -559,6 +602,19 @@ func PostPost(c *gin.Context) {
 	}
 	post.UserID = new(bson.ObjectId)
 	*post.UserID = bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
+
+	if *post.IsPublish && !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't publish post",
+		})
+		return
+	}
+
+	if !schedulePost(c, post, role) {
+		return
+	}
 
 	post.CategoryName = strings.TrimSpace(post.CategoryName)
 	if post.CategoryName != "" {
@@ -575,26 +631,27 @@ func PostPost(c *gin.Context) {
 
 		if len(categories) > 0 {
 			post.CategoryID = categories[0].ID
-			categories[0].PostCount, _ = database.PostCount(bson.M{
-				"$or": []bson.M{
-					bson.M{
-						"category_id": categories[0].ID,
-						"is_publish":  true,
-					},
-					bson.M{
-						"category_id": categories[0].ID,
-						"is_publish":  false,
-						"user_id":     post.UserID,
-					},
-				},
-			})
+			categories[0].PostCount, _ = database.PostCount(visiblePostFilter(*post.UserID, role, bson.M{
+				"category_id": categories[0].ID,
+			}))
 			categories[0].PostCount++
 			post.Category = &categories[0]
 		} else {
+			if !hasPermission(role, PermCategoryManage) {
+				c.JSON(http.StatusForbidden, errRes{
+					Status:  http.StatusForbidden,
+					Message: "Can't create category",
+				})
+				return
+			}
+
 			category := structure.Category{
 				Name: post.CategoryName,
 			}
-			err = database.InsertCategory(&category)
+			category.Slug, err = uniqueSlug("categories", category.Name, nil)
+			if err == nil {
+				err = database.InsertCategory(&category)
+			}
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, errRes{
 					Status:  http.StatusInternalServerError,
@@ -603,6 +660,8 @@ func PostPost(c *gin.Context) {
 				return
 			}
 
+			audit(c, structure.AuditCategoryCreate, category.ID.Hex(), nil, &category)
+
 			post.CategoryID = category.ID
 			post.Category = &category
 			post.Category.PostCount = 1
@@ -613,6 +672,15 @@ func PostPost(c *gin.Context) {
 	post.ID = nil
 	post.CategoryName = ""
 
+	if !validFormat(c, post) {
+		return
+	}
+
+	post.Slug, ok = resolveSlug(c, "posts", post.Slug, post.Title, "", nil)
+	if !ok {
+		return
+	}
+
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = post.CreatedAt
 
@@ -627,11 +695,17 @@ func PostPost(c *gin.Context) {
 		// TODO: delete category if it is just created
 	}
 
+	audit(c, structure.AuditPostCreate, post.ID.Hex(), nil, post)
+
 	// retrieve user
-	post.User = new(structure.User)
-	*post.User, _ = database.User(bson.M{
+	owner, _ := database.User(bson.M{
 		"_id": post.UserID,
 	})
+	post.User = owner.Author()
+
+	if !renderPost(c, post) {
+		return
+	}
 
 	c.JSON(http.StatusCreated, post)
 }
@@ -679,6 +753,8 @@ func PostCategoryPost(c *gin.Context) {
 
 	// trim space
 	post.Title = strings.TrimSpace(post.Title)
+	post.Excerpt = strings.TrimSpace(post.Excerpt)
+	post.Tags = normalizeTags(post.Tags)
 	if post.Title == "" {
 		// empty category name
 		c.JSON(http.StatusBadRequest, errRes{
@@ -722,11 +798,33 @@ func PostCategoryPost(c *gin.Context) {
 	}
 	post.UserID = new(bson.ObjectId)
 	*post.UserID = bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
+
+	if *post.IsPublish && !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't publish post",
+		})
+		return
+	}
+
+	if !schedulePost(c, post, role) {
+		return
+	}
 
 	// set id and CategoryName zero value to omit it
 	post.ID = nil
 	post.CategoryName = ""
 
+	if !validFormat(c, post) {
+		return
+	}
+
+	post.Slug, ok = resolveSlug(c, "posts", post.Slug, post.Title, "", nil)
+	if !ok {
+		return
+	}
+
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = post.CreatedAt
 
@@ -741,27 +839,23 @@ func PostCategoryPost(c *gin.Context) {
 		// TODO: delete category if it is just created
 	}
 
+	audit(c, structure.AuditPostCreate, post.ID.Hex(), nil, post)
+
 	// retrieve user
-	post.User = new(structure.User)
-	*post.User, _ = database.User(bson.M{
+	owner, _ := database.User(bson.M{
 		"_id": post.UserID,
 	})
+	post.User = owner.Author()
 
 	// retrieve category
 	post.Category = &categories[0]
-	post.Category.PostCount, _ = database.PostCount(bson.M{
-		"$or": []bson.M{
-			bson.M{
-				"category_id": oid,
-				"is_publish":  true,
-			},
-			bson.M{
-				"category_id": oid,
-				"is_publish":  false,
-				"user_id":     post.UserID,
-			},
-		},
-	})
+	post.Category.PostCount, _ = database.PostCount(visiblePostFilter(*post.UserID, role, bson.M{
+		"category_id": oid,
+	}))
+
+	if !renderPost(c, post) {
+		return
+	}
 
 	c.JSON(http.StatusCreated, post)
 }
@@ -789,11 +883,17 @@ func UpdatePost(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
-	posts, err := database.Posts(bson.M{
-		"_id":     oid,
-		"user_id": userID,
-	})
+	filter := bson.M{
+		"_id": oid,
+	}
+	if !hasPermission(role, PermPostEditOthers) {
+		// only the owner can edit the post
+		filter["user_id"] = userID
+	}
+
+	posts, err := database.Posts(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -810,13 +910,33 @@ func UpdatePost(c *gin.Context) {
 		return
 	}
 
+	if posts[0].IsPublish != nil && *posts[0].IsPublish &&
+		!hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't edit published post",
+		})
+		return
+	}
+
+	if posts[0].PublishAt != nil && !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't edit scheduled post",
+		})
+		return
+	}
+
+	originPost := posts[0]
+
 	var post structure.Post
 	if c.Request.Method == "PUT" {
 		// for PUT request, use a new category struct,
 		// binding with the request body, so the category
 		// will be exactly the same as request body,
-		// the value of some field that doesn't will be empty
-		err = c.ShouldBindJSON(&post)
+		// the value of some field that doesn't will be empty,
+		// the body is kept to check if publish_at is set to null
+		err = c.ShouldBindBodyWith(&post, binding.JSON)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, errRes{
 				Status:  http.StatusBadRequest,
@@ -829,7 +949,7 @@ func UpdatePost(c *gin.Context) {
 		// binding with request body, so the value of some field that
 		// doesn't provide will not change
 		post = posts[0]
-		err = c.ShouldBindJSON(&post)
+		err = c.ShouldBindBodyWith(&post, binding.JSON)
 		if err != nil {
 			_, ok := err.(validator.ValidationErrors)
 			if !ok {
@@ -842,6 +962,21 @@ func UpdatePost(c *gin.Context) {
 		}
 	}
 
+	if post.IsPublish != nil && *post.IsPublish && !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't publish post",
+		})
+		return
+	}
+
+	if !schedulePost(c, &post, role) {
+		return
+	}
+
+	// the owner of the post, which may not be current user
+	ownerID := posts[0].UserID
+
 	post.CategoryName = strings.TrimSpace(post.CategoryName)
 	if post.CategoryName != posts[0].CategoryName {
 		// category changes
@@ -859,26 +994,27 @@ func UpdatePost(c *gin.Context) {
 
 			if len(categories) > 0 {
 				post.CategoryID = categories[0].ID
-				categories[0].PostCount, _ = database.PostCount(bson.M{
-					"$or": []bson.M{
-						bson.M{
-							"category_id": categories[0].ID,
-							"is_publish":  true,
-						},
-						bson.M{
-							"category_id": categories[0].ID,
-							"is_publish":  false,
-							"user_id":     userID,
-						},
-					},
-				})
+				categories[0].PostCount, _ = database.PostCount(visiblePostFilter(userID, role, bson.M{
+					"category_id": categories[0].ID,
+				}))
 				categories[0].PostCount++
 				post.Category = &categories[0]
 			} else {
+				if !hasPermission(role, PermCategoryManage) {
+					c.JSON(http.StatusForbidden, errRes{
+						Status:  http.StatusForbidden,
+						Message: "Can't create category",
+					})
+					return
+				}
+
 				category := structure.Category{
 					Name: post.CategoryName,
 				}
-				err = database.InsertCategory(&category)
+				category.Slug, err = uniqueSlug("categories", category.Name, nil)
+				if err == nil {
+					err = database.InsertCategory(&category)
+				}
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, errRes{
 						Status:  http.StatusInternalServerError,
@@ -887,6 +1023,8 @@ func UpdatePost(c *gin.Context) {
 					return
 				}
 
+				audit(c, structure.AuditCategoryCreate, category.ID.Hex(), nil, &category)
+
 				post.CategoryID = category.ID
 				post.Category = &category
 				post.Category.PostCount = 1
@@ -906,19 +1044,9 @@ func UpdatePost(c *gin.Context) {
 				return
 			}
 			if len(categories) > 0 {
-				categories[0].PostCount, _ = database.PostCount(bson.M{
-					"$or": []bson.M{
-						bson.M{
-							"category_id": posts[0].CategoryID,
-							"is_publish":  true,
-						},
-						bson.M{
-							"category_id": posts[0].CategoryID,
-							"is_publish":  false,
-							"user_id":     userID,
-						},
-					},
-				})
+				categories[0].PostCount, _ = database.PostCount(visiblePostFilter(userID, role, bson.M{
+					"category_id": posts[0].CategoryID,
+				}))
 				posts[0].Category = &categories[0]
 			}
 
@@ -936,6 +1064,8 @@ func UpdatePost(c *gin.Context) {
 
 	// trim space
 	post.Title = strings.TrimSpace(post.Title)
+	post.Excerpt = strings.TrimSpace(post.Excerpt)
+	post.Tags = normalizeTags(post.Tags)
 	if post.Title == "" {
 		// empty category name
 		c.JSON(http.StatusBadRequest, errRes{
@@ -964,13 +1094,43 @@ func UpdatePost(c *gin.Context) {
 		return
 	}
 
+	if !validFormat(c, &post) {
+		return
+	}
+
+	post.Slug, ok = resolveSlug(c, "posts", post.Slug, post.Title, originPost.Slug, &oid)
+	if !ok {
+		return
+	}
+
+	// keep the previous version
+	err = savePostRevision(originPost, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the post isn't updated if it has been changed since it's
+	// retrieved, so a concurrent edit isn't overwritten silently
 	err = database.UpdatePost(
 		bson.M{
-			"_id": oid,
+			"_id":        oid,
+			"updated_at": originPost.UpdatedAt,
 		},
 		post,
 	)
 	if err != nil {
+		if err == database.ErrNoPost {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "Post has been changed, retrieve it and try again",
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
 			Message: "Internal server error",
@@ -979,17 +1139,49 @@ func UpdatePost(c *gin.Context) {
 	}
 
 	post.ID = &oid
+	moveSlug("posts", oid, originPost.Slug, post.Slug)
+
+	if post.PublishAt == nil && originPost.PublishAt != nil {
+		if (post.IsPublish != nil && *post.IsPublish) || publishAtCleared(c) {
+			// the schedule is canceled or the post is published now
+			err = database.UnschedulePost(oid)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+		} else {
+			// publish_at is omitted, the schedule is kept
+			post.PublishAt = originPost.PublishAt
+		}
+	}
+
+	// fields omitted in the update are kept,
+	// so get the updated post for audit log
+	posts, err = database.Posts(bson.M{
+		"_id": oid,
+	})
+	if err == nil && len(posts) > 0 {
+		audit(c, structure.AuditPostUpdate, oid.Hex(), &originPost, &posts[0])
+	}
 
 	// retrieve user
-	post.User = new(structure.User)
-	*post.User, _ = database.User(bson.M{
-		"_id": userID,
+	owner, _ := database.User(bson.M{
+		"_id": ownerID,
 	})
+	post.User = owner.Author()
+
+	if !renderPost(c, &post) {
+		return
+	}
 
 	c.JSON(http.StatusCreated, post)
 }
 
-// DeletePost handles the DELETE request of url path "/admin/posts/:id"
+// DeletePost handles the DELETE request of url path "/admin/posts/:id",
+// the post is moved to trash
 func DeletePost(c *gin.Context) {
 	// parse object id from url path
 	if !bson.IsObjectIdHex(c.Param("id")) {
@@ -1011,11 +1203,31 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
 
-	err := database.RemovePosts(bson.M{
-		"_id":     oid,
-		"user_id": userID,
-	})
+	filter := bson.M{
+		"_id": oid,
+	}
+	if !hasPermission(role, PermPostEditOthers) {
+		// only the owner can delete the post
+		filter["user_id"] = userID
+	}
+	if !hasPermission(role, PermPostPublish) {
+		// published post can't be deleted without publish permission
+		filter["is_publish"] = false
+	}
+
+	posts, err := database.Posts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the post is kept in trash until it's purged
+	err = database.TrashPosts(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -1024,5 +1236,9 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
+	if len(posts) > 0 {
+		audit(c, structure.AuditPostDelete, oid.Hex(), &posts[0], nil)
+	}
+
 	c.JSON(http.StatusNoContent, nil)
 }
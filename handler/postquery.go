@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+)
+
+// defaultPostSort the sort of post listings, the latest post first
+const defaultPostSort = "-created_at"
+
+// postSortFields the fields posts can be sorted by
+var postSortFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"title":      true,
+}
+
+// parsePostSort parses query parameter "sort" of post listings,
+// the field is prefixed with "-" for descending order, responds
+// with an error if the field isn't allowed
+func parsePostSort(c *gin.Context) (string, bool) {
+	sort := c.DefaultQuery("sort", defaultPostSort)
+	if !postSortFields[strings.TrimPrefix(sort, "-")] {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid sort, must be one of created_at, updated_at and title",
+		})
+		return "", false
+	}
+
+	return sort, true
+}
+
+// parsePostQuery parses the sort and the page of post listings
+func parsePostQuery(c *gin.Context) (*pagination, bool) {
+	sort, ok := parsePostSort(c)
+	if !ok {
+		return nil, false
+	}
+
+	return parsePagination(c, sort)
+}
+
+// parsePostFilter parses the filter of post listings from query
+// parameters "tag", "author", "category", "created_after" and
+// "created_before", and "status" and "is_publish" if admin is true,
+// the time is in RFC 3339 format, responds with an error if a
+// parameter is invalid
+func parsePostFilter(c *gin.Context, admin bool) (bson.M, bool) {
+	filter := bson.M{}
+
+	if tags := normalizeTags(c.QueryArray("tag")); len(tags) > 0 {
+		filter["tags"] = bson.M{
+			"$all": tags,
+		}
+	}
+
+	for param, field := range map[string]string{"author": "user_id", "category": "category_id"} {
+		if c.Query(param) == "" {
+			continue
+		}
+
+		if !bson.IsObjectIdHex(c.Query(param)) {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invaild " + param + " id",
+			})
+			return nil, false
+		}
+		filter[field] = bson.ObjectIdHex(c.Query(param))
+	}
+
+	createdAt := bson.M{}
+	for param, operator := range map[string]string{"created_after": "$gt", "created_before": "$lt"} {
+		if c.Query(param) == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, c.Query(param))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid time " + param,
+			})
+			return nil, false
+		}
+		createdAt[operator] = t
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	if admin && c.Query("status") != "" && c.Query("is_publish") != "" {
+		// status also filters is_publish, one would override the other
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Status can't be used with is_publish",
+		})
+		return nil, false
+	}
+
+	if admin && c.Query("status") != "" {
+		status, ok := statusFilter(c.Query("status"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Status must be draft, scheduled or published",
+			})
+			return nil, false
+		}
+		for key, value := range status {
+			filter[key] = value
+		}
+	}
+
+	if admin && c.Query("is_publish") != "" {
+		isPublish, err := strconv.ParseBool(c.Query("is_publish"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid is_publish",
+			})
+			return nil, false
+		}
+		filter["is_publish"] = isPublish
+	}
+
+	return filter, true
+}
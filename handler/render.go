@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jaaaaason/hmblog/render"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// validFormat checks the content format of a created or updated post,
+// empty format is markdown, responds with an error if it's invalid
+func validFormat(c *gin.Context, post *structure.Post) bool {
+	if !render.ValidFormat(post.Format) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Format must be markdown, html or plain",
+		})
+		return false
+	}
+
+	if post.Format == "" {
+		post.Format = render.FormatMarkdown
+	}
+
+	return true
+}
+
+// renderPost sets the state of the post, the sanitized html of its
+// content and the excerpt if the author doesn't supply one, responds
+// with an error if it fails, the result is cached until the post changes
+func renderPost(c *gin.Context, post *structure.Post) bool {
+	post.Status = postStatus(*post)
+
+	if post.Format == "" {
+		// posts created before formats were introduced
+		post.Format = render.FormatMarkdown
+	}
+
+	var rendered render.Rendered
+	var err error
+	if post.ID != nil {
+		rendered, err = render.Cached(post.ID.Hex(), post.Format, post.Content)
+	} else {
+		rendered, err = render.Render(post.Format, post.Content)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return false
+	}
+
+	post.ContentHTML = rendered.HTML
+	if strings.TrimSpace(post.Excerpt) == "" {
+		post.Excerpt = rendered.Excerpt
+	}
+
+	return true
+}
+
+// fullContent reports whether a post listing includes the content,
+// which is requested by query parameter "full=true"
+func fullContent(c *gin.Context) bool {
+	full, _ := strconv.ParseBool(c.Query("full"))
+	return full
+}
+
+// renderPosts renders the posts of a listing, the content is
+// omitted unless the full content is requested
+func renderPosts(c *gin.Context, posts []structure.Post) bool {
+	full := fullContent(c)
+	for i := range posts {
+		if !renderPost(c, &posts[i]) {
+			return false
+		}
+
+		if !full {
+			posts[i].Content = ""
+			posts[i].ContentHTML = ""
+		}
+	}
+
+	return true
+}
+
+// renderSearchResults renders the posts of the search results
+// like renderPosts
+func renderSearchResults(c *gin.Context, results []structure.SearchResult) bool {
+	full := fullContent(c)
+	for i := range results {
+		if !renderPost(c, &results[i].Post) {
+			return false
+		}
+
+		if !full {
+			results[i].Content = ""
+			results[i].ContentHTML = ""
+		}
+	}
+
+	return true
+}
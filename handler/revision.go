@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/diff"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// defaultRevisionKeep the amount of latest revisions kept
+// if it's not given in config
+const defaultRevisionKeep = 50
+
+// savePostRevision saves the post as a revision before it's updated
+// by the editor, and removes the revisions out of retention
+func savePostRevision(post structure.Post, editorID bson.ObjectId) error {
+	revision := structure.PostRevision{
+		PostID:     post.ID,
+		Title:      post.Title,
+		Content:    post.Content,
+		Format:     post.Format,
+		Excerpt:    post.Excerpt,
+		Tags:       post.Tags,
+		CategoryID: post.CategoryID,
+		EditorID:   &editorID,
+		CreatedAt:  time.Now(),
+	}
+
+	err := database.InsertPostRevision(&revision)
+	if err != nil {
+		return err
+	}
+
+	keep := configer.Config.RevisionKeep
+	if keep == 0 {
+		keep = defaultRevisionKeep
+	}
+	var since time.Time
+	if configer.Config.RevisionDays > 0 {
+		since = time.Now().AddDate(0, 0, -configer.Config.RevisionDays)
+	}
+
+	return database.PrunePostRevisions(*post.ID, keep, since)
+}
+
+// revisionText returns the text of a version of the post to diff
+func revisionText(title string, format string, tags []string, content string) string {
+	if format == "" {
+		format = "markdown"
+	}
+
+	return "title: " + title + "\n" +
+		"format: " + format + "\n" +
+		"tags: " + strings.Join(tags, ", ") + "\n" +
+		"\n" + content
+}
+
+// editablePost retrieves the post of url path "/admin/posts/:id"
+// which can be edited by current user, responds with an error
+// if the post isn't found
+func editablePost(c *gin.Context) (*structure.Post, bool) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return nil, false
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	// get user id
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return nil, false
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+
+	filter := bson.M{
+		"_id": oid,
+	}
+	if !hasPermission(c.GetString("role"), PermPostEditOthers) {
+		// only the owner can edit the post
+		filter["user_id"] = userID
+	}
+
+	posts, err := database.Posts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return nil, false
+	}
+
+	if len(posts) < 1 {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No post found",
+		})
+		return nil, false
+	}
+
+	return &posts[0], true
+}
+
+// postRevision retrieves the revision of the post by the number in
+// the parameter, responds with an error if it isn't found
+func postRevision(c *gin.Context, postID bson.ObjectId, param string) (*structure.PostRevision, bool) {
+	number, err := strconv.Atoi(param)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid revision number",
+		})
+		return nil, false
+	}
+
+	revision, err := database.PostRevision(postID, number)
+	if err != nil {
+		if err == database.ErrNoPostRevision {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No revision found",
+			})
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return nil, false
+	}
+
+	return revision, true
+}
+
+// GetPostRevisions handles the GET request of url path
+// "/admin/posts/:id/revisions", the latest revision first
+func GetPostRevisions(c *gin.Context) {
+	post, ok := editablePost(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := database.PostRevisions(*post.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if revisions == nil {
+		revisions = []structure.PostRevision{}
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetPostRevisionDiff handles the GET request of url path
+// "/admin/posts/:id/revisions/diff", returns the unified diff between
+// the versions of query parameters "from" and "to", each of them is a
+// revision number or "current", which is the default of "to", "from"
+// is the latest revision by default
+func GetPostRevisionDiff(c *gin.Context) {
+	post, ok := editablePost(c)
+	if !ok {
+		return
+	}
+
+	version := func(param string) (string, string, bool) {
+		if param == "current" {
+			return "current", revisionText(post.Title, post.Format, post.Tags, post.Content), true
+		}
+
+		revision, ok := postRevision(c, *post.ID, param)
+		if !ok {
+			return "", "", false
+		}
+
+		return "revision " + strconv.Itoa(revision.Number),
+			revisionText(revision.Title, revision.Format, revision.Tags, revision.Content), true
+	}
+
+	from := c.Query("from")
+	if from == "" {
+		revisions, err := database.PostRevisions(*post.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if len(revisions) < 1 {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No revision found",
+			})
+			return
+		}
+		from = strconv.Itoa(revisions[0].Number)
+	}
+
+	fromName, fromText, ok := version(from)
+	if !ok {
+		return
+	}
+	toName, toText, ok := version(c.DefaultQuery("to", "current"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, structure.RevisionDiff{
+		From: fromName,
+		To:   toName,
+		Diff: diff.Unified(fromName, toName, fromText, toText),
+	})
+}
+
+// PostPostRevisionRestore handles the POST request of url path
+// "/admin/posts/:id/revisions/:rev/restore", the title, content,
+// format, excerpt and tags of the post are restored to the revision,
+// and the current version is saved as a new revision
+func PostPostRevisionRestore(c *gin.Context) {
+	post, ok := editablePost(c)
+	if !ok {
+		return
+	}
+	oid := *post.ID
+	userID := bson.ObjectIdHex(c.GetString("user_id"))
+	role := c.GetString("role")
+
+	if post.IsPublish != nil && *post.IsPublish &&
+		!hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't edit published post",
+		})
+		return
+	}
+
+	if post.PublishAt != nil && !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't edit scheduled post",
+		})
+		return
+	}
+
+	revision, ok := postRevision(c, oid, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	posts, err := database.Posts(bson.M{
+		"title": revision.Title,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(posts) > 0 && *posts[0].ID != oid {
+		// post with this title exists
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Post with this title already exists",
+		})
+		return
+	}
+
+	originPost := *post
+
+	err = savePostRevision(originPost, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the other fields are kept
+	restored := originPost
+	restored.ID = nil
+	restored.Title = revision.Title
+	restored.Content = revision.Content
+	restored.Format = revision.Format
+	restored.Excerpt = revision.Excerpt
+	restored.Tags = revision.Tags
+	restored.UpdatedAt = time.Now()
+
+	// the post isn't updated if it has been changed since it's
+	// retrieved, so a concurrent edit isn't overwritten silently
+	err = database.UpdatePost(
+		bson.M{
+			"_id":        oid,
+			"updated_at": originPost.UpdatedAt,
+		},
+		restored,
+	)
+	if err != nil {
+		if err == database.ErrNoPost {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "Post has been changed, retrieve it and try again",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the empty fields are omitted in the update above, so they
+	// are removed explicitly to use the derived values again
+	var unset []string
+	if restored.Excerpt == "" {
+		unset = append(unset, "excerpt")
+	}
+	if restored.Format == "" {
+		unset = append(unset, "format")
+	}
+	if len(unset) > 0 {
+		err = database.UnsetPostFields(oid, unset...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	// fields omitted in the update are kept,
+	// so get the updated post for audit log
+	posts, err = database.Posts(bson.M{
+		"_id": oid,
+	})
+	if err != nil || len(posts) < 1 {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	audit(c, structure.AuditPostRestore, oid.Hex(), &originPost, &posts[0])
+
+	// retrieve user
+	owner, _ := database.User(bson.M{
+		"_id": posts[0].UserID,
+	})
+	posts[0].User = owner.Author()
+
+	if !renderPost(c, &posts[0]) {
+		return
+	}
+
+	c.JSON(http.StatusOK, posts[0])
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// schedulePost checks the publishing time of a created or updated post,
+// a post with a future time is unpublished until the scheduler publishes
+// it, a post with a past time is published now, responds with an error
+// if current user can't publish posts
+func schedulePost(c *gin.Context, post *structure.Post, role string) bool {
+	if post.PublishAt == nil {
+		return true
+	}
+
+	if !hasPermission(role, PermPostPublish) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't schedule post",
+		})
+		return false
+	}
+
+	isPublish := !post.PublishAt.After(time.Now())
+	if isPublish {
+		// the time has come
+		post.PublishAt = nil
+	}
+	post.IsPublish = &isPublish
+
+	return true
+}
+
+// publishAtCleared reports whether the request body bound by
+// ShouldBindBodyWith sets publish_at to null explicitly
+func publishAtCleared(c *gin.Context) bool {
+	body, ok := c.Get(gin.BodyBytesKey)
+	if !ok {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body.([]byte), &fields); err != nil {
+		return false
+	}
+
+	value, ok := fields["publish_at"]
+	return ok && bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// postStatus returns the state of the post,
+// which is draft, scheduled or published
+func postStatus(post structure.Post) string {
+	if post.IsPublish != nil && *post.IsPublish {
+		return structure.PostPublished
+	}
+
+	if post.PublishAt != nil {
+		return structure.PostScheduled
+	}
+
+	return structure.PostDraft
+}
+
+// statusFilter returns the filter of posts in the state,
+// false if the state is invalid
+func statusFilter(status string) (bson.M, bool) {
+	switch status {
+	case structure.PostDraft:
+		return bson.M{
+			"is_publish": false,
+			"publish_at": bson.M{
+				"$exists": false,
+			},
+		}, true
+
+	case structure.PostScheduled:
+		return bson.M{
+			"is_publish": false,
+			"publish_at": bson.M{
+				"$exists": true,
+			},
+		}, true
+
+	case structure.PostPublished:
+		return bson.M{
+			"is_publish": true,
+		}, true
+	}
+
+	return nil, false
+}
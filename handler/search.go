@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/search"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// parseSearch parses the query and the page of a search, the results
+// are ranked by relevance so only "limit" and "offset" are supported
+func parseSearch(c *gin.Context) (string, *pagination, bool) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Query q is required",
+		})
+		return "", nil, false
+	}
+
+	if c.Query("cursor") != "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Cursor isn't supported by search",
+		})
+		return "", nil, false
+	}
+
+	page, ok := parsePagination(c, "score")
+	if !ok {
+		return "", nil, false
+	}
+	page.useOffset = true
+
+	return query, page, true
+}
+
+// searchResults retrieves the posts of the search results in the same
+// order, countFilter returns the filter of posts visible to the user,
+// which also filters the results since the index may be out of date
+func searchResults(results []search.Result, countFilter func(bson.M) bson.M) ([]structure.SearchResult, error) {
+	ids := make([]bson.ObjectId, 0, len(results))
+	for _, result := range results {
+		if bson.IsObjectIdHex(result.ID) {
+			ids = append(ids, bson.ObjectIdHex(result.ID))
+		}
+	}
+
+	posts, err := database.Posts(countFilter(bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	postByID := make(map[string]structure.Post)
+	for _, post := range posts {
+		postByID[post.ID.Hex()] = post
+	}
+
+	found := []structure.SearchResult{}
+	for _, result := range results {
+		post, ok := postByID[result.ID]
+		if !ok {
+			// removed or hidden after indexed
+			continue
+		}
+
+		err := postRelations(&post, countFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		found = append(found, structure.SearchResult{
+			Post:  post,
+			Score: result.Score,
+			Highlight: structure.SearchHighlight{
+				Title:   result.Title,
+				Content: result.Snippet,
+			},
+		})
+	}
+
+	return found, nil
+}
+
+// GetSearch handles the GET request of url path "/search",
+// searches the title, content and tags of published posts
+// for query parameter "q"
+func GetSearch(c *gin.Context) {
+	query, page, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+
+	results, total := search.Search(query, func(doc search.Document) bool {
+		return doc.IsPublish
+	}, page.offset, page.limit)
+
+	posts, err := searchResults(results, publishedFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if !renderSearchResults(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), nil)
+	c.JSON(http.StatusOK, posts)
+}
+
+// GetAdminSearch handles the GET request of url path "/admin/search",
+// searches the posts visible to current user, including own drafts
+func GetAdminSearch(c *gin.Context) {
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
+
+	query, page, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+
+	editOthers := hasPermission(role, PermPostEditOthers)
+	results, total := search.Search(query, func(doc search.Document) bool {
+		return editOthers || doc.IsPublish || doc.UserID == userID.Hex()
+	}, page.offset, page.limit)
+
+	posts, err := searchResults(results, visibleFilter(userID, role))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if !renderSearchResults(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), nil)
+	c.JSON(http.StatusOK, posts)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// startSession creates a login session for the user and issues
+// the tokens, the session starts a new refresh token family
+func startSession(c *gin.Context, userID bson.ObjectId) (gin.H, error) {
+	familyID := bson.NewObjectId()
+
+	now := time.Now()
+	err := database.InsertSession(&structure.Session{
+		ID:         &familyID,
+		UserID:     &userID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Second * refreshTokenExp),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(userID, familyID)
+}
+
+// revokeSession removes the session and
+// revokes the refresh tokens of it
+func revokeSession(sid bson.ObjectId) error {
+	err := database.RevokeRefreshTokens(bson.M{
+		"family_id": sid,
+	})
+	if err != nil {
+		return err
+	}
+
+	return database.RemoveSessions(bson.M{
+		"_id": sid,
+	})
+}
+
+// sessionOwner parses the user id from url path, responds
+// with an error if the current user can't manage the sessions
+func sessionOwner(c *gin.Context) (bson.ObjectId, bool) {
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return "", false
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	if oid.Hex() != c.GetString("user_id") &&
+		!hasPermission(c.GetString("role"), PermUserManage) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't manage other user's sessions",
+		})
+		return "", false
+	}
+
+	return oid, true
+}
+
+// GetUserSessions handles the GET request for url path
+// "/admin/users/:id/sessions", returns the active sessions
+func GetUserSessions(c *gin.Context) {
+	oid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := database.Sessions(bson.M{
+		"user_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if sessions == nil {
+		sessions = []structure.Session{}
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == c.GetString("session_id")
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteUserSession handles the DELETE request for url path
+// "/admin/users/:id/sessions/:sid", signs out the session
+func DeleteUserSession(c *gin.Context) {
+	oid, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	if !bson.IsObjectIdHex(c.Param("sid")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild session id",
+		})
+		return
+	}
+	sid := bson.ObjectIdHex(c.Param("sid"))
+
+	session, err := database.Session(bson.M{
+		"_id":     sid,
+		"user_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoSession {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such session",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = revokeSession(sid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, structure.AuditSessionDelete, sid.Hex(), &session, nil)
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"github.com/rainycape/unidecode"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+)
+
+const maxSlugLength = 80
+
+// slugPattern lower case letters and digits separated by single hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validSlug reports whether the slug can be used in url path
+func validSlug(slug string) bool {
+	return len(slug) <= maxSlugLength && slugPattern.MatchString(slug)
+}
+
+// slugify returns the slug of the title, non-ASCII characters are
+// transliterated, such as Chinese characters to pinyin
+func slugify(title string) string {
+	var words []string
+	word := ""
+	for _, r := range strings.ToLower(unidecode.Unidecode(title)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			word += string(r)
+			continue
+		}
+
+		if word != "" {
+			words = append(words, word)
+			word = ""
+		}
+	}
+	if word != "" {
+		words = append(words, word)
+	}
+
+	// keep whole words within the maximum length,
+	// leaving room for a number suffix
+	slug := ""
+	for _, word := range words {
+		if slug != "" && len(slug)+1+len(word) > maxSlugLength-4 {
+			break
+		}
+		if slug != "" {
+			slug += "-"
+		}
+		slug += word
+	}
+	if len(slug) > maxSlugLength-4 {
+		slug = strings.Trim(slug[:maxSlugLength-4], "-")
+	}
+
+	return slug
+}
+
+// slugTaken reports whether the slug is used by another document of
+// the collection, now or before, selfID is nil for a new document
+func slugTaken(collection string, slug string, selfID *bson.ObjectId) (bool, error) {
+	filter := bson.M{
+		"slug": slug,
+	}
+	if selfID != nil {
+		filter["_id"] = bson.M{
+			"$ne": *selfID,
+		}
+	}
+
+	var count int
+	var err error
+	if collection == "categories" {
+		count, err = database.CategoryCount(filter)
+	} else {
+		count, err = database.PostCount(filter)
+	}
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	// the slug of a document in trash is kept for restoring
+	filter["deleted_at"] = bson.M{
+		"$exists": true,
+	}
+	if collection == "categories" {
+		count, err = database.CategoryCount(filter)
+	} else {
+		count, err = database.PostCount(filter)
+	}
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	// a previous slug still redirects to its document
+	history, err := database.SlugHistory(collection, slug)
+	if err != nil {
+		if err == database.ErrNoSlugHistory {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return selfID == nil || history.TargetID == nil || *history.TargetID != *selfID, nil
+}
+
+// uniqueSlug returns an unused slug generated from the title,
+// a number is appended if the slug is taken
+func uniqueSlug(collection string, title string, selfID *bson.ObjectId) (string, error) {
+	base := slugify(title)
+	if base == "" {
+		// nothing can be transliterated
+		base = strings.TrimSuffix(collection, "s")
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := slugTaken(collection, slug, selfID)
+		if err != nil || !taken {
+			return slug, err
+		}
+
+		slug = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// resolveSlug returns the slug of a created or updated document,
+// the requested slug is used if it's given, otherwise the origin slug
+// is kept, or generated from the title if there is no origin slug,
+// responds with an error if the requested slug is invalid or taken
+func resolveSlug(c *gin.Context, collection string, requested string, title string, origin string, selfID *bson.ObjectId) (string, bool) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" && origin != "" {
+		return origin, true
+	}
+
+	if requested == "" {
+		slug, err := uniqueSlug(collection, title, selfID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return "", false
+		}
+
+		return slug, true
+	}
+
+	if requested == origin {
+		return origin, true
+	}
+
+	if !validSlug(requested) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Slug must be lower case letters and digits separated by hyphens",
+		})
+		return "", false
+	}
+
+	taken, err := slugTaken(collection, requested, selfID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return "", false
+	}
+	if taken {
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Slug already exists",
+		})
+		return "", false
+	}
+
+	return requested, true
+}
+
+// moveSlug keeps the origin slug of an updated document in history,
+// failures are logged since the document has been updated
+func moveSlug(collection string, id bson.ObjectId, origin string, slug string) {
+	if origin == slug {
+		return
+	}
+
+	err := database.MoveSlug(collection, id, origin, slug)
+	if err != nil {
+		logger.Error("failed to save slug history: " + err.Error())
+	}
+}
+
+// InitializeSlugs generates the slugs of posts and
+// categories created before slugs were introduced
+func InitializeSlugs() error {
+	noSlug := bson.M{
+		"slug": bson.M{
+			"$exists": false,
+		},
+	}
+
+	categories, err := database.Categories(noSlug)
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		id := *category.ID
+		category.ID = nil
+		category.Slug, err = uniqueSlug("categories", category.Name, &id)
+		if err != nil {
+			return err
+		}
+
+		err = database.UpdateCategory(bson.M{"_id": id}, category)
+		if err != nil {
+			return err
+		}
+	}
+
+	posts, err := database.Posts(noSlug)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		id := *post.ID
+		post.ID = nil
+		post.Slug, err = uniqueSlug("posts", post.Title, &id)
+		if err != nil {
+			return err
+		}
+
+		err = database.UpdatePost(bson.M{"_id": id}, post)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		slug  string
+	}{
+		{"ascii", "Hello World", "hello-world"},
+		{"punctuation", "  Go 1.12: what's new?!  ", "go-1-12-what-s-new"},
+		{"accents", "Crème brûlée à Paris", "creme-brulee-a-paris"},
+		{"chinese", "你好世界", "ni-hao-shi-jie"},
+		{"mixed", "Go 语言入门", "go-yu-yan-ru-men"},
+		{"only symbols", "!!! ???", ""},
+		{"empty", "", ""},
+		{"whole words", strings.Repeat("abcde ", 20), strings.TrimSuffix(strings.Repeat("abcde-", 12), "-")},
+		{"long word", strings.Repeat("a", 100), strings.Repeat("a", maxSlugLength-4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug := slugify(tt.title)
+			if slug != tt.slug {
+				t.Errorf("slugify(%q) = %q, want %q", tt.title, slug, tt.slug)
+			}
+			if slug != "" && !validSlug(slug) {
+				t.Errorf("slugify(%q) = %q, which isn't a valid slug", tt.title, slug)
+			}
+		})
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	tests := []struct {
+		slug  string
+		valid bool
+	}{
+		{"hello-world", true},
+		{"go-1-12", true},
+		{"a", true},
+		{strings.Repeat("a", maxSlugLength), true},
+		{strings.Repeat("a", maxSlugLength+1), false},
+		{"", false},
+		{"Hello", false},
+		{"-hello", false},
+		{"hello-", false},
+		{"hello--world", false},
+		{"hello_world", false},
+		{"你好", false},
+	}
+
+	for _, tt := range tests {
+		if valid := validSlug(tt.slug); valid != tt.valid {
+			t.Errorf("validSlug(%q) = %v, want %v", tt.slug, valid, tt.valid)
+		}
+	}
+}
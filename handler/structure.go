@@ -1,7 +1,26 @@
 package handler
 
+import (
+	"time"
+
+	"github.com/jaaaaason/hmblog/structure"
+)
+
 // ErrRes error data structure for response
 type errRes struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 }
+
+// newUserRes data structure of created user for response
+type newUserRes struct {
+	structure.User
+	InvitationToken     string     `json:"invitation_token,omitempty"`
+	InvitationExpiresAt *time.Time `json:"invitation_expires_at,omitempty"`
+}
+
+// newAccessTokenRes data structure of created access token for response
+type newAccessTokenRes struct {
+	structure.AccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+	"golang.org/x/text/width"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// normalizeTag returns the tag in lower case with full-width
+// characters folded to half-width, and whitespace collapsed
+// into single spaces
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(width.Fold.String(tag))
+
+	return strings.Join(strings.Fields(tag), " ")
+}
+
+// normalizeTags normalizes the tags, the empty
+// and duplicated tags are removed
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// InitializeTags normalizes the tags of posts
+// created before tags were normalized
+func InitializeTags() error {
+	tags, err := database.AllTags()
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		normalized := normalizeTag(tag)
+		if normalized == tag {
+			continue
+		}
+
+		// the tag is removed if it's just some whitespace
+		_, err = database.ReplaceTags([]string{tag}, normalized)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTags handles the GET request of url path "/tags",
+// returns the tags with the amount of published posts
+func GetTags(c *gin.Context) {
+	tags, err := database.Tags(bson.M{
+		"is_publish": true,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if tags == nil {
+		tags = []structure.Tag{}
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetTagPosts handles the GET request of url path
+// "/tags/:tag/posts", returns the published posts with the tag
+func GetTagPosts(c *gin.Context) {
+	tag := normalizeTag(c.Param("tag"))
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid tag",
+		})
+		return
+	}
+
+	query, ok := parsePostFilter(c, false)
+	if !ok {
+		return
+	}
+	// combined with "$and", the query may contain "tags"
+	filter := andFilter(bson.M{
+		"tags":       tag,
+		"is_publish": true,
+	}, query)
+
+	page, ok := parsePostQuery(c)
+	if !ok {
+		return
+	}
+
+	total, err := database.PostCount(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	posts, err := database.PostsPage(page.filter(filter), page.sortFields(), page.offset, page.limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	for i := range posts {
+		if err := postRelations(&posts[i], publishedFilter); err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	if posts == nil {
+		posts = []structure.Post{}
+	}
+
+	if !renderPosts(c, posts) {
+		return
+	}
+
+	setPageHeaders(c, page, total, len(posts), postCursor(page, posts))
+	c.JSON(http.StatusOK, posts)
+}
+
+// GetAdminTags handles the GET request of url path "/admin/tags",
+// returns the tags with the amount of posts visible to current user
+func GetAdminTags(c *gin.Context) {
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+
+	tags, err := database.Tags(visiblePostFilter(userID, c.GetString("role"), nil))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if tags == nil {
+		tags = []structure.Tag{}
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// replaceTags replaces the tags by the tag into in all posts and
+// responds with the tag, responds with an error if no post has
+// any of the tags
+func replaceTags(c *gin.Context, action string, tags []string, into string) {
+	count, err := database.PostCount(bson.M{
+		"tags": bson.M{
+			"$in": tags,
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if count < 1 {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No such tag",
+		})
+		return
+	}
+
+	_, err = database.ReplaceTags(tags, into)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, action, into, bson.M{"tags": tags}, bson.M{"tags": []string{into}})
+
+	tag := structure.Tag{
+		Name: into,
+	}
+	tag.PostCount, err = database.PostCount(bson.M{
+		"tags": into,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// UpdateTag handles the PUT request of url path "/admin/tags/:tag",
+// the tag is renamed in all posts, it's merged into the tag with
+// the new name if there is one
+func UpdateTag(c *gin.Context) {
+	var rename structure.TagRename
+	if err := c.ShouldBindJSON(&rename); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	tag := normalizeTag(c.Param("tag"))
+	name := normalizeTag(rename.Name)
+	if tag == "" || name == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Tag shouldn't be just some whitespace",
+		})
+		return
+	}
+
+	replaceTags(c, structure.AuditTagRename, []string{tag}, name)
+}
+
+// PostTagMerge handles the POST request of url path
+// "/admin/tags/merge", the tags are merged into one tag in all posts
+func PostTagMerge(c *gin.Context) {
+	var merge structure.TagMerge
+	if err := c.ShouldBindJSON(&merge); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	tags := normalizeTags(merge.Tags)
+	into := normalizeTag(merge.Into)
+	if len(tags) == 0 || into == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Tag shouldn't be just some whitespace",
+		})
+		return
+	}
+
+	replaceTags(c, structure.AuditTagMerge, tags, into)
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// randomToken creates a url-safe random token with 32 bytes of entropy
+func randomToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// hashToken returns the hex encoded sha256 hash of the token,
+// only the hash of a token is stored in database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates an access token and a refresh token
+// of the refresh token family for the user
+func issueTokens(userID bson.ObjectId, familyID bson.ObjectId) (gin.H, error) {
+	claims := jwt.MapClaims{
+		"exp": time.Now().Add(time.Second * tokenExp).Unix(),
+		"iat": time.Now().Unix(),
+		"jti": bson.NewObjectId().Hex(),
+		"sid": familyID.Hex(),
+	}
+	claims["user_id"] = userID
+
+	accessToken, err := signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := structure.RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		UserID:    &userID,
+		FamilyID:  &familyID,
+		CreatedAt: time.Now(),
+	}
+	token.ExpiresAt = token.CreatedAt.Add(time.Second * refreshTokenExp)
+
+	err = database.InsertRefreshToken(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"access_token":  accessToken,
+		"token_type":    tokenType,
+		"expires_in":    tokenExp,
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+// PostTokenRefresh handles the POST request for /admin/token/refresh,
+// the refresh token is rotated, replaying a used refresh token
+// revokes all tokens of its family
+func PostTokenRefresh(c *gin.Context) {
+	var refresh structure.TokenRefresh
+	if err := c.ShouldBindJSON(&refresh); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	token, err := database.RefreshToken(bson.M{
+		"token_hash": hashToken(refresh.RefreshToken),
+	})
+	if err != nil {
+		if err == database.ErrNoRefreshToken {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid refresh token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if token.Revoked || time.Now().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid refresh token",
+		})
+		return
+	}
+
+	err = database.UseRefreshToken(*token.ID)
+	if err != nil {
+		if err == database.ErrNoRefreshToken {
+			// the token has been used before, it may be stolen,
+			// revoke the whole session
+			err = revokeSession(*token.FamilyID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Refresh token has been used",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// check if user still exists
+	user, err := database.User(bson.M{
+		"_id": token.UserID,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid refresh token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return
+	}
+
+	// the session may have been revoked
+	now := time.Now()
+	err = database.UpdateSession(
+		bson.M{
+			"_id": token.FamilyID,
+		},
+		structure.Session{
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(time.Second * refreshTokenExp),
+		},
+	)
+	if err != nil {
+		if err == database.ErrNoSession {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Session is revoked",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	res, err := issueTokens(*token.UserID, *token.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeUserTokens revokes all sessions, jwt tokens, refresh
+// tokens and access tokens that have been issued to the user
+func RevokeUserTokens(userID bson.ObjectId) error {
+	err := database.RevokeRefreshTokens(bson.M{
+		"user_id": userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// access tokens may be created by someone who took over
+	// the account, they are removed with the sessions
+	err = database.RemoveAccessTokens(bson.M{
+		"user_id": userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = database.RemoveSessions(bson.M{
+		"user_id": userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// tokens issued in the current second are kept, since
+	// the "iat" claim of token only has second precision
+	now := time.Now()
+	return database.InsertRevokedToken(&structure.RevokedToken{
+		UserID:       &userID,
+		IssuedBefore: now.Truncate(time.Second),
+		ExpiresAt:    now.Add(time.Second * tokenExp),
+	})
+}
+
+// PostLogout handles the POST request for /admin/logout,
+// revokes the current access token and its session
+func PostLogout(c *gin.Context) {
+	jti := c.GetString("jti")
+	sid := c.GetString("session_id")
+
+	err := database.InsertRevokedToken(&structure.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: c.GetTime("token_exp"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if bson.IsObjectIdHex(sid) {
+		err = revokeSession(bson.ObjectIdHex(sid))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	audit(c, structure.AuditLogout, c.GetString("user_id"), nil, nil)
+	c.JSON(http.StatusNoContent, nil)
+}
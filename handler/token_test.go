@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+func TestAccessTokenRejectedAfterPasswordReset(t *testing.T) {
+	defer testDatabase(t)()
+
+	user := testUser(t, "alice", structure.RoleAuthor, "correct horse battery")
+
+	token := accessTokenPrefix + "test-token"
+	err := database.InsertAccessToken(&structure.AccessToken{
+		Name:      "script",
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Scopes:    []string{ScopePostRead},
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("database.InsertAccessToken() error = %v", err)
+	}
+
+	resetToken := "reset-token"
+	err = database.InsertPasswordReset(&structure.PasswordReset{
+		TokenHash: hashToken(resetToken),
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("database.InsertPasswordReset() error = %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/admin/posts", AccessTokenMiddleware(), ScopeMiddleware(ScopePostRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.POST("/admin/password-reset/confirm", PostPasswordResetConfirm)
+
+	if w := testRequest(r, http.MethodGet, "/admin/posts", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("status before reset = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w := testRequest(r, http.MethodPost, "/admin/password-reset/confirm", "", structure.PasswordResetConfirm{
+		Token:    resetToken,
+		Password: "a new strong passphrase",
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("reset status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+
+	if w := testRequest(r, http.MethodGet, "/admin/posts", token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("status after reset = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,680 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+const (
+	totpIssuer           = "HMBlog"
+	totpPeriod           = 30 // seconds of a time step
+	totpDigits           = 6
+	totpSkew             = 1 // time steps allowed before and after the current one
+	recoveryCodeCount    = 10
+	loginChallengeExp    = 300 // 5 minutes, 300 seconds
+	loginChallengeLimits = 5   // failed attempts allowed for a login challenge
+)
+
+// base32NoPadding the encoding used by TOTP secrets and recovery codes
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode computes the RFC 6238 TOTP code of the time step
+func totpCode(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, see RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// validateTOTP checks the code against the base32 encoded secret,
+// returns the time step that the code matches
+func validateTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// normalizeRecoveryCode removes separators and spaces of a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Replace(code, " ", "", -1)
+}
+
+// newRecoveryCodes creates one-time recovery codes,
+// returns the codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		bytes := make([]byte, 5)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32NoPadding.EncodeToString(bytes))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+
+	return codes, hashes, nil
+}
+
+// verifySecondFactor checks the code of a user who has enabled two-factor
+// authentication, the code is either a TOTP code or a recovery code,
+// and it can't be used again
+func verifySecondFactor(user structure.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if step, ok := validateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		err := database.UseTOTPStep(*user.ID, step)
+		if err == database.ErrTOTPCodeUsed {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err := database.UseRecoveryCode(*user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err == database.ErrNoRecoveryCode {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// newLoginChallenge creates a login challenge for the user,
+// returns the challenge token
+func newLoginChallenge(userID bson.ObjectId) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := structure.LoginChallenge{
+		TokenHash: hashToken(token),
+		UserID:    &userID,
+		CreatedAt: time.Now(),
+	}
+	challenge.ExpiresAt = challenge.CreatedAt.Add(time.Second * loginChallengeExp)
+
+	err = database.InsertLoginChallenge(&challenge)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// respondLoginChallenge responds with a login challenge of the
+// user, the login is finished by PostLoginTOTP with a TOTP code
+func respondLoginChallenge(c *gin.Context, userID bson.ObjectId) {
+	challengeToken, err := newLoginChallenge(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge_token": challengeToken,
+		"challenge_type":  "totp",
+		"expires_in":      loginChallengeExp,
+	})
+}
+
+// PostLoginTOTP handles the POST request for /admin/login/totp,
+// exchanges the challenge token of password login and a valid
+// TOTP code or recovery code for the JWT token
+func PostLoginTOTP(c *gin.Context) {
+	var login structure.TOTPLogin
+	if err := c.ShouldBindJSON(&login); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	challenge, err := database.LoginChallenge(bson.M{
+		"token_hash": hashToken(login.ChallengeToken),
+	})
+	if err != nil {
+		if err == database.ErrNoLoginChallenge {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid challenge token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid challenge token",
+		})
+		return
+	}
+
+	// the attempt is counted before the code is checked
+	err = database.AttemptLoginChallenge(*challenge.ID, loginChallengeLimits)
+	if err != nil {
+		if err == database.ErrNoLoginChallenge {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid challenge token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	user, err := database.User(bson.M{
+		"_id": challenge.UserID,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid challenge token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// wrong codes count as failed logins of the user
+	ip := c.ClientIP()
+	lockout, err := loginLockout(user.Username, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if !lockout.IsZero() {
+		abortLockedLogin(c, lockout)
+		return
+	}
+
+	// the user may be changed since the password is checked
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return
+	}
+	if !user.IsTOTPEnabled() {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid challenge token",
+		})
+		return
+	}
+
+	ok, err := verifySecondFactor(user, login.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if !ok {
+		err = recordLoginFailure(user.Username, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+
+		auditAs(c, nil, structure.AuditLoginFailure, user.Username, nil, nil)
+
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid code",
+		})
+		return
+	}
+
+	// the challenge can only be used once, concurrent
+	// requests with the same challenge fail here
+	_, err = database.UseLoginChallenge(bson.M{
+		"token_hash": challenge.TokenHash,
+	})
+	if err != nil {
+		if err == database.ErrNoLoginChallenge {
+			c.JSON(http.StatusUnauthorized, errRes{
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid challenge token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// reset the failure counter of the username
+	err = resetLoginFailures(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	res, err := startSession(c, *user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	auditAs(c, user.ID, structure.AuditLogin, user.ID.Hex(), nil, nil)
+
+	if user.IsPasswordChangeRequired() {
+		res["must_change_password"] = true
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// PostUserTOTP handles the POST request for url path
+// "/admin/users/:id/totp", creates a pending TOTP secret
+// which takes effect after it is verified
+func PostUserTOTP(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	if c.GetString("user_id") != oid.Hex() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't enroll TOTP for other user",
+		})
+		return
+	}
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "TOTP is already enabled",
+		})
+		return
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	secret := base32NoPadding.EncodeToString(key)
+
+	err = database.UpdateUser(
+		bson.M{
+			"_id": oid,
+		},
+		structure.User{
+			TOTPSecret: secret,
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, structure.AuditUserTOTPEnroll, oid.Hex(),
+		&structure.User{TOTPSecret: user.TOTPSecret},
+		&structure.User{TOTPSecret: secret},
+	)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"secret": secret,
+		"otpauth_uri": "otpauth://totp/" +
+			url.PathEscape(totpIssuer+":"+user.Username) +
+			"?" + query.Encode(),
+	})
+}
+
+// PostUserTOTPVerify handles the POST request for url path
+// "/admin/users/:id/totp/verify", enables the pending TOTP secret
+// with a valid code, and returns the recovery codes
+func PostUserTOTPVerify(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	if c.GetString("user_id") != oid.Hex() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't enroll TOTP for other user",
+		})
+		return
+	}
+
+	var code structure.TOTPCode
+	if err := c.ShouldBindJSON(&code); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if user.IsTOTPEnabled() {
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "TOTP is already enabled",
+		})
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No pending TOTP secret",
+		})
+		return
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, strings.TrimSpace(code.Code), time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid code",
+		})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	enabled := true
+	err = database.UpdateUser(
+		bson.M{
+			"_id": oid,
+		},
+		structure.User{
+			TOTPEnabled:   &enabled,
+			TOTPLastStep:  step,
+			RecoveryCodes: hashes,
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, structure.AuditUserTOTPEnable, oid.Hex(),
+		&structure.User{TOTPEnabled: user.TOTPEnabled},
+		&structure.User{TOTPEnabled: &enabled, RecoveryCodes: hashes},
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DeleteUserTOTP handles the DELETE request for url path
+// "/admin/users/:id/totp", the user disables TOTP with a valid
+// TOTP code or recovery code, users who can manage users
+// disable it for others without a code
+func DeleteUserTOTP(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	self := c.GetString("user_id") == oid.Hex()
+	if !self && !hasPermission(c.GetString("role"), PermUserManage) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't disable TOTP for other user",
+		})
+		return
+	}
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if self && user.IsTOTPEnabled() {
+		var code structure.TOTPCode
+		if err := c.ShouldBindJSON(&code); err != nil {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Bad request",
+			})
+			return
+		}
+
+		// the code is guessed with a stolen token,
+		// so it's limited by the same counters as login
+		ip := c.ClientIP()
+		lockout, err := loginLockout(user.Username, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if !lockout.IsZero() {
+			abortLockedLogin(c, lockout)
+			return
+		}
+
+		ok, err := verifySecondFactor(user, code.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if !ok {
+			err = recordLoginFailure(user.Username, ip)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid code",
+			})
+			return
+		}
+	}
+
+	err = database.DisableTOTP(oid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the pending logins can't be completed without TOTP
+	err = database.RemoveLoginChallenges(bson.M{
+		"user_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	disabled := false
+	audit(c, structure.AuditUserTOTPDisable, oid.Hex(),
+		&structure.User{TOTPEnabled: user.TOTPEnabled, TOTPSecret: user.TOTPSecret},
+		&structure.User{TOTPEnabled: &disabled},
+	)
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret the base32 encoded key "12345678901234567890"
+// of the SHA-1 test vectors in RFC 6238 appendix B
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// the 8 digit codes of RFC 6238 truncated to the last 6 digits
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		now    int64
+		step   int64
+		valid  bool
+	}{
+		{"rfc 59", rfc6238Secret, "287082", 59, 1, true},
+		{"rfc 1111111109", rfc6238Secret, "081804", 1111111109, 37037036, true},
+		{"rfc 1111111111", rfc6238Secret, "050471", 1111111111, 37037037, true},
+		{"rfc 1234567890", rfc6238Secret, "005924", 1234567890, 41152263, true},
+		{"rfc 2000000000", rfc6238Secret, "279037", 2000000000, 66666666, true},
+		{"rfc 20000000000", rfc6238Secret, "353130", 20000000000, 666666666, true},
+		{"previous step", rfc6238Secret, "081804", 1111111109 + totpPeriod, 37037036, true},
+		{"next step", rfc6238Secret, "081804", 1111111109 - totpPeriod, 37037036, true},
+		{"out of skew", rfc6238Secret, "081804", 1111111109 + 2*totpPeriod, 0, false},
+		{"wrong code", rfc6238Secret, "000000", 59, 0, false},
+		{"8 digit code", rfc6238Secret, "94287082", 59, 0, false},
+		{"empty code", rfc6238Secret, "", 59, 0, false},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, valid := validateTOTP(tt.secret, tt.code, time.Unix(tt.now, 0))
+			if valid != tt.valid || step != tt.step {
+				t.Errorf("validateTOTP(%q, %q, %d) = %d, %v, want %d, %v",
+					tt.secret, tt.code, tt.now, step, valid, tt.step, tt.valid)
+			}
+		})
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		step int64
+		code string
+	}{
+		{1, "287082"},
+		{37037036, "081804"},
+		{37037037, "050471"},
+		{41152263, "005924"},
+		{66666666, "279037"},
+		{666666666, "353130"},
+	}
+
+	for _, tt := range tests {
+		if code := totpCode(key, tt.step); code != tt.code {
+			t.Errorf("totpCode(step %d) = %q, want %q", tt.step, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/structure"
+)
+
+// trashPostFilter returns the filter of the deleted posts
+// the user can see and restore
+func trashPostFilter(userID bson.ObjectId, role string) bson.M {
+	filter := bson.M{}
+	if !hasPermission(role, PermPostEditOthers) {
+		// only the owner can restore the post
+		filter["user_id"] = userID
+	}
+	if !hasPermission(role, PermPostPublish) {
+		// published post can't be restored without publish permission
+		filter["is_publish"] = false
+	}
+
+	return filter
+}
+
+// GetTrash handles the GET request of url path "/admin/trash",
+// the categories are included if the user can manage categories
+func GetTrash(c *gin.Context) {
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
+
+	posts, err := database.DeletedPosts(trashPostFilter(userID, role))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	for i := range posts {
+		if posts[i].UserID != nil {
+			// retrieve post's owner
+			user, err := database.User(bson.M{
+				"_id": posts[i].UserID,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+			posts[i].User = user.Author()
+		}
+	}
+
+	if !renderPosts(c, posts) {
+		return
+	}
+
+	trash := structure.Trash{
+		Posts:      posts,
+		Categories: []structure.Category{},
+	}
+	if trash.Posts == nil {
+		trash.Posts = []structure.Post{}
+	}
+
+	// an access token also requires the scope to read categories
+	scopes, ok := c.Get("scopes")
+	if hasPermission(role, PermCategoryManage) &&
+		(!ok || hasScope(scopes.([]string), ScopeCategoryRead)) {
+		categories, err := database.DeletedCategories(nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if categories != nil {
+			trash.Categories = categories
+		}
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+// PostTrashPostRestore handles the POST request of url path
+// "/admin/trash/posts/:id/restore", the post is moved out of trash
+func PostTrashPostRestore(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	// get user id
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+
+	filter := trashPostFilter(userID, c.GetString("role"))
+	filter["_id"] = oid
+
+	posts, err := database.DeletedPosts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(posts) < 1 {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No post found in trash",
+		})
+		return
+	}
+	deletedPost := posts[0]
+
+	posts, err = database.Posts(bson.M{
+		"title": deletedPost.Title,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(posts) > 0 {
+		// another post took the title after it's deleted
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Post with this title already exists",
+		})
+		return
+	}
+
+	err = database.RestorePost(filter)
+	if err != nil {
+		if err == database.ErrNoPost {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No post found in trash",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	post := deletedPost
+	post.DeletedAt = nil
+	audit(c, structure.AuditPostUndelete, oid.Hex(), &deletedPost, &post)
+
+	// retrieve user
+	owner, _ := database.User(bson.M{
+		"_id": post.UserID,
+	})
+	post.User = owner.Author()
+
+	if !renderPost(c, &post) {
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// PostTrashCategoryRestore handles the POST request of url path
+// "/admin/trash/categories/:id/restore", the category is moved
+// out of trash
+func PostTrashCategoryRestore(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	categories, err := database.DeletedCategories(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(categories) < 1 {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No category found in trash",
+		})
+		return
+	}
+	deletedCategory := categories[0]
+
+	categories, err = database.Categories(bson.M{
+		"name": deletedCategory.Name,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(categories) > 0 {
+		// another category took the name after it's deleted
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Category name already exists",
+		})
+		return
+	}
+
+	err = database.RestoreCategory(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoCategory {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No category found in trash",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	category := deletedCategory
+	category.DeletedAt = nil
+	audit(c, structure.AuditCategoryUndelete, oid.Hex(), &deletedCategory, &category)
+
+	c.JSON(http.StatusOK, category)
+}
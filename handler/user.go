@@ -3,6 +3,7 @@ package handler
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -27,6 +28,26 @@ func UpdateUser(c *gin.Context) {
 
 	oid := bson.ObjectIdHex(c.Param("id"))
 
+	// get user id
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+	role := c.GetString("role")
+
+	if userID != oid && !hasPermission(role, PermUserManage) {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "Can't change other user's information",
+		})
+		return
+	}
+
 	user, err := database.User(bson.M{
 		"_id": oid,
 	})
@@ -46,6 +67,12 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// the user is changed by binding request body, take
+	// a snapshot of the stored fields for audit log
+	originFields := auditFields(&user)
+	originRole := user.Role
+	originDisabled := user.IsDisabled()
+	originMustChangePassword := user.IsPasswordChangeRequired()
 	if c.Request.Method == "PUT" {
 		// for PUT request, use a new user struct,
 		// binding with the request body, so the category
@@ -81,6 +108,16 @@ func UpdateUser(c *gin.Context) {
 	// set id zero value to omit it
 	user.ID = nil
 
+	// credentials and two-factor authentication
+	// can't be changed here, omit them
+	originTOTPEnabled := user.IsTOTPEnabled()
+	user.PasswordHash = nil
+	user.MustChangePassword = nil
+	user.TOTPSecret = ""
+	user.TOTPEnabled = nil
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+
 	// trim space
 	user.Username = strings.TrimSpace(user.Username)
 	if user.Username == "" {
@@ -92,6 +129,73 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !validProfile(user) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Profile links must be http or https urls",
+		})
+		return
+	}
+
+	if user.Role != "" && user.Role != originRole {
+		// role changes
+		if !hasPermission(role, PermUserManage) {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Can't change user's role",
+			})
+			return
+		}
+
+		if !structure.IsValidRole(user.Role) {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid role",
+			})
+			return
+		}
+
+		if originRole == structure.RoleOwner {
+			// keep at least one owner
+			owners, err := database.Users(bson.M{
+				"role": structure.RoleOwner,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+			if len(owners) < 2 {
+				c.JSON(http.StatusConflict, errRes{
+					Status:  http.StatusConflict,
+					Message: "Can't change the role of the last owner",
+				})
+				return
+			}
+		}
+	}
+
+	if user.Disabled != nil && user.IsDisabled() != originDisabled {
+		// account is disabled or enabled
+		if !hasPermission(role, PermUserManage) {
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Can't disable or enable user",
+			})
+			return
+		}
+
+		if userID == oid {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "Can't disable yourself",
+			})
+			return
+		}
+	}
+
 	users, err := database.Users(bson.M{
 		"username": user.Username,
 	})
@@ -111,6 +215,28 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if user.Email != "" {
+		user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+		users, err = database.Users(bson.M{
+			"email": user.Email,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if len(users) > 0 && *users[0].ID != oid {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "Email already exists",
+			})
+			return
+		}
+	}
+
 	err = database.UpdateUser(
 		bson.M{
 			"_id": oid,
@@ -125,7 +251,36 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if user.IsDisabled() && !originDisabled {
+		// sign out all sessions of the disabled user
+		err = RevokeUserTokens(oid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
 	user.ID = &oid
+	if user.Role == "" {
+		user.Role = originRole
+	}
+	if user.Disabled == nil {
+		user.Disabled = &originDisabled
+	}
+	// fields omitted in the update are kept,
+	// so get the updated user for audit log
+	updatedUser, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err == nil {
+		audit(c, structure.AuditUserUpdate, oid.Hex(), originFields, &updatedUser)
+	}
+
+	user.TOTPEnabled = &originTOTPEnabled
+	user.MustChangePassword = &originMustChangePassword
 	c.JSON(http.StatusCreated, user)
 }
 
@@ -133,7 +288,8 @@ func UpdateUser(c *gin.Context) {
 // for url path "/admin/user/:id/password"
 func UpdateUserPassword(c *gin.Context) {
 	type newPassword struct {
-		Password string `json:"password" binding:"required"`
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password" binding:"required"`
 	}
 
 	// parse object id from url path
@@ -175,12 +331,85 @@ func UpdateUserPassword(c *gin.Context) {
 		return
 	}
 
+	originUser, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// a user without password, who signed in some other way,
+	// sets the first password without the current one
+	if len(originUser.PasswordHash) > 0 {
+		if newPsw.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Bad Request",
+			})
+			return
+		}
+
+		// the current password is guessed with a stolen token,
+		// so it's limited by the same counters as login
+		ip := c.ClientIP()
+		lockout, err := loginLockout(originUser.Username, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if !lockout.IsZero() {
+			abortLockedLogin(c, lockout)
+			return
+		}
+
+		err = bcrypt.CompareHashAndPassword(
+			originUser.PasswordHash,
+			[]byte(newPsw.CurrentPassword),
+		)
+		if err != nil {
+			err = recordLoginFailure(originUser.Username, ip)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, errRes{
+					Status:  http.StatusInternalServerError,
+					Message: "Internal server error",
+				})
+				return
+			}
+
+			c.JSON(http.StatusForbidden, errRes{
+				Status:  http.StatusForbidden,
+				Message: "Wrong current password",
+			})
+			return
+		}
+	}
+
+	if err = CheckPassword(originUser.Username, newPsw.Password); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Weak password, " + err.Error(),
+		})
+		return
+	}
+
 	var user structure.User
-	var err error
-	user.PasswordHash, err = bcrypt.GenerateFromPassword(
-		[]byte(newPsw.Password),
-		bcrypt.DefaultCost,
-	)
+	user.MustChangePassword = new(bool)
+	user.PasswordHash, err = HashPassword(newPsw.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errRes{
 			Status:  http.StatusInternalServerError,
@@ -211,5 +440,498 @@ func UpdateUserPassword(c *gin.Context) {
 		return
 	}
 
+	audit(c, structure.AuditUserPassword, oid.Hex(),
+		&structure.User{PasswordHash: originUser.PasswordHash},
+		&structure.User{PasswordHash: user.PasswordHash},
+	)
+
+	// sign out all sessions of the user
+	err = RevokeUserTokens(oid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// GetUsers handles the GET request for url path "/admin/users"
+func GetUsers(c *gin.Context) {
+	users, err := database.Users(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// PostUser handles the POST request for url path "/admin/users",
+// an invitation token is returned if password isn't given,
+// with which the new user sets their own password
+func PostUser(c *gin.Context) {
+	newUser := new(structure.NewUser)
+	if err := c.ShouldBindJSON(newUser); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	// trim space
+	newUser.Username = strings.TrimSpace(newUser.Username)
+	if newUser.Username == "" {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Username shouldn't be just some whitespace",
+		})
+		return
+	}
+
+	if !structure.IsValidRole(newUser.Role) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid role",
+		})
+		return
+	}
+
+	users, err := database.Users(bson.M{
+		"username": newUser.Username,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	if len(users) > 0 {
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Username already exists",
+		})
+		return
+	}
+
+	if newUser.Email != "" {
+		newUser.Email = strings.ToLower(strings.TrimSpace(newUser.Email))
+
+		users, err = database.Users(bson.M{
+			"email": newUser.Email,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		if len(users) > 0 {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "Email already exists",
+			})
+			return
+		}
+	}
+
+	if newUser.Password != "" {
+		if err = CheckPassword(newUser.Username, newUser.Password); err != nil {
+			c.JSON(http.StatusBadRequest, errRes{
+				Status:  http.StatusBadRequest,
+				Message: "Weak password, " + err.Error(),
+			})
+			return
+		}
+	}
+
+	user := structure.User{
+		Username: newUser.Username,
+		Email:    newUser.Email,
+		Role:     newUser.Role,
+		Disabled: new(bool),
+	}
+	if newUser.Password != "" {
+		// the password is known by the creator,
+		// the user must change it on first login
+		mustChangePassword := true
+		user.MustChangePassword = &mustChangePassword
+
+		user.PasswordHash, err = HashPassword(newUser.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	err = database.InsertUser(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	audit(c, structure.AuditUserCreate, user.ID.Hex(), nil, &user)
+
+	res := newUserRes{
+		User: user,
+	}
+	if newUser.Password == "" {
+		// invite the user to set their own password
+		res.InvitationToken, err = randomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+
+		invitation := structure.Invitation{
+			TokenHash: hashToken(res.InvitationToken),
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+		}
+		invitation.ExpiresAt = invitation.CreatedAt.Add(time.Second * invitationExp)
+
+		err = database.InsertInvitation(&invitation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+		res.InvitationExpiresAt = &invitation.ExpiresAt
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+// DeleteUser handles the DELETE request for url path "/admin/users/:id",
+// posts of the user are reassigned to the user given by
+// query parameter "reassign_to"
+func DeleteUser(c *gin.Context) {
+	// parse object id from url path
+	if !bson.IsObjectIdHex(c.Param("id")) {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Invaild id",
+		})
+		return
+	}
+	oid := bson.ObjectIdHex(c.Param("id"))
+
+	// get user id
+	idStr, ok := c.Get("user_id")
+	if !ok || !bson.IsObjectIdHex(idStr.(string)) {
+		c.JSON(http.StatusUnauthorized, errRes{
+			Status:  http.StatusUnauthorized,
+			Message: "Invalid JWT token",
+		})
+		return
+	}
+	userID := bson.ObjectIdHex(idStr.(string))
+
+	if userID == oid {
+		c.JSON(http.StatusConflict, errRes{
+			Status:  http.StatusConflict,
+			Message: "Can't delete yourself",
+		})
+		return
+	}
+
+	count, err := database.PostCount(bson.M{
+		"user_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the posts in trash are reassigned too,
+	// so they can still be restored
+	deletedCount, err := database.PostCount(bson.M{
+		"user_id": oid,
+		"deleted_at": bson.M{
+			"$exists": true,
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if count+deletedCount > 0 {
+		reassignTo := c.Query("reassign_to")
+		if !bson.IsObjectIdHex(reassignTo) || bson.ObjectIdHex(reassignTo) == oid {
+			c.JSON(http.StatusConflict, errRes{
+				Status:  http.StatusConflict,
+				Message: "User has posts, reassign them with reassign_to",
+			})
+			return
+		}
+
+		_, err = database.User(bson.M{
+			"_id": bson.ObjectIdHex(reassignTo),
+		})
+		if err != nil {
+			if err == database.ErrNoUser {
+				c.JSON(http.StatusBadRequest, errRes{
+					Status:  http.StatusBadRequest,
+					Message: "No user to reassign posts to",
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+
+		err = database.ReassignPosts(
+			bson.M{
+				"user_id": oid,
+			},
+			bson.ObjectIdHex(reassignTo),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errRes{
+				Status:  http.StatusInternalServerError,
+				Message: "Internal server error",
+			})
+			return
+		}
+	}
+
+	user, err := database.User(bson.M{
+		"_id": oid,
+	})
+	if err != nil && err != database.ErrNoUser {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+	found := err == nil
+
+	err = database.RemoveUsers(bson.M{
+		"_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if found {
+		audit(c, structure.AuditUserDelete, oid.Hex(), &user, nil)
+	}
+
+	err = database.RemoveInvitations(bson.M{
+		"user_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = RevokeUserTokens(oid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.RemoveAccessTokens(bson.M{
+		"user_id": oid,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// PostInvitationAccept handles the POST request for
+// url path "/admin/invitations/accept", the invited user
+// sets their password with the invitation token
+func PostInvitationAccept(c *gin.Context) {
+	accept := new(structure.InvitationAccept)
+	if err := c.ShouldBindJSON(accept); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Bad request",
+		})
+		return
+	}
+
+	invitation, err := database.Invitation(bson.M{
+		"token_hash": hashToken(accept.Token),
+	})
+	if err != nil {
+		if err == database.ErrNoInvitation {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No invitation found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		c.JSON(http.StatusNotFound, errRes{
+			Status:  http.StatusNotFound,
+			Message: "No invitation found",
+		})
+		return
+	}
+
+	invitedUser, err := database.User(bson.M{
+		"_id": invitation.UserID,
+	})
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	if invitedUser.IsDisabled() {
+		c.JSON(http.StatusForbidden, errRes{
+			Status:  http.StatusForbidden,
+			Message: "User is disabled",
+		})
+		return
+	}
+
+	if err = CheckPassword(invitedUser.Username, accept.Password); err != nil {
+		c.JSON(http.StatusBadRequest, errRes{
+			Status:  http.StatusBadRequest,
+			Message: "Weak password, " + err.Error(),
+		})
+		return
+	}
+
+	// the invitation can only be used once, consume it before
+	// setting the password so concurrent requests can't both pass
+	_, err = database.UseInvitation(bson.M{
+		"_id":        invitation.ID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		if err == database.ErrNoInvitation {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No invitation found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	var user structure.User
+	user.PasswordHash, err = HashPassword(accept.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	err = database.UpdateUser(
+		bson.M{
+			"_id": invitation.UserID,
+		},
+		user,
+	)
+	if err != nil {
+		if err == database.ErrNoUser {
+			c.JSON(http.StatusNotFound, errRes{
+				Status:  http.StatusNotFound,
+				Message: "No such user",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	// the user proved the ownership of the mailbox with the token
+	auditAs(c, invitation.UserID, structure.AuditUserInvitation, invitation.UserID.Hex(),
+		&structure.User{PasswordHash: invitedUser.PasswordHash},
+		&structure.User{PasswordHash: user.PasswordHash},
+	)
+
+	// other invitations of the user are no longer needed
+	err = database.RemoveInvitations(bson.M{
+		"user_id": invitation.UserID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errRes{
+			Status:  http.StatusInternalServerError,
+			Message: "Internal server error",
+		})
+		return
+	}
+
 	c.JSON(http.StatusNoContent, nil)
 }
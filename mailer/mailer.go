@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/jaaaaason/hmblog/configer"
+)
+
+// ErrNoSMTP returned when the smtp server isn't configured
+var ErrNoSMTP = errors.New("smtp server isn't configured")
+
+// ErrInvalidHeader returned when a header contains line breaks
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// Send sends a plain text mail with the smtp server given in configuration
+func Send(to string, subject string, body string) error {
+	conf := configer.Config.SMTP
+	if conf.Host == "" {
+		return ErrNoSMTP
+	}
+
+	// line breaks in headers let the caller inject other headers
+	if strings.ContainsAny(to+subject+conf.From, "\r\n") {
+		return ErrInvalidHeader
+	}
+
+	port := conf.Port
+	if port == 0 {
+		port = 25
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", conf.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	// the smtp server may not require authentication,
+	// such as a local relay
+	var auth smtp.Auth
+	if conf.Username != "" {
+		auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	return smtp.SendMail(
+		fmt.Sprintf("%s:%d", conf.Host, port),
+		auth,
+		conf.From,
+		[]string{to},
+		msg.Bytes(),
+	)
+}
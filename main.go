@@ -11,11 +11,13 @@ import (
 	"github.com/jaaaaason/hmblog/database"
 	"github.com/jaaaaason/hmblog/handler"
 	"github.com/jaaaaason/hmblog/logger"
+	"github.com/jaaaaason/hmblog/scheduler"
 )
 
 func main() {
 	// get config file's path with commandline arg
 	confFilepath := flag.String("c", "", "the config file's path")
+	flag.Parse()
 
 	var err error
 	if *confFilepath == "" {
@@ -51,6 +53,70 @@ func main() {
 	}
 	defer database.CloseSession()
 
+	if flag.NArg() > 0 {
+		// run the admin command instead of starting the server
+		err = runCommand(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	// create the first user, the password can be given
+	// in config file or environment variable
+	password := configer.Config.AdminPassword
+	if os.Getenv("HMBLOG_ADMIN_PASSWORD") != "" {
+		password = os.Getenv("HMBLOG_ADMIN_PASSWORD")
+	}
+
+	createdPassword, err := database.InitBlogUser(password, handler.PasswordCost())
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+	if createdPassword != "" {
+		logger.Info("created a default user \"admin\", " +
+			"the password must be changed on first login")
+
+		if password == "" {
+			// never write the random password to log file
+			fmt.Fprintln(os.Stderr, "created a default user:\n"+
+				"username: admin\n"+
+				"password: "+createdPassword)
+		}
+	}
+
+	// generate slugs of posts and categories created before
+	err = handler.InitializeSlugs()
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+
+	// normalize tags of posts created before
+	err = handler.InitializeTags()
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+
+	// build the search index of posts
+	err = database.IndexPosts()
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+
+	// publish the scheduled posts and purge the trash in background
+	scheduler.Start()
+
+	// load the keys used to sign and verify jwt token
+	err = handler.InitializeJWT()
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 	r.Use(handler.CORSMiddleware())
@@ -60,6 +126,11 @@ func main() {
 	adminRouter.Use(handler.JWTMiddleware())
 	registerAdminRoute(adminRouter)
 
+	// admin routes which also accept personal access tokens
+	adminTokenRouter := r.Group("/admin")
+	adminTokenRouter.Use(handler.AccessTokenMiddleware())
+	registerAdminTokenRoute(adminTokenRouter)
+
 	var addr string
 	if configer.Config.Listen > 0 {
 		// use given port in config file
@@ -75,39 +146,198 @@ func main() {
 // registerRoute registers api route
 func registerRoute(r *gin.Engine) {
 	r.POST("/admin/login", handler.PostLogin)
+	r.POST("/admin/login/totp", handler.PostLoginTOTP)
+	r.GET("/admin/oidc/login", handler.GetOIDCLogin)
+	r.POST("/admin/oidc/callback", handler.PostOIDCCallback)
+	r.POST("/admin/token/refresh", handler.PostTokenRefresh)
+	r.POST("/admin/invitations/accept", handler.PostInvitationAccept)
+	r.POST("/admin/password-reset", handler.PostPasswordReset)
+	r.POST("/admin/password-reset/confirm", handler.PostPasswordResetConfirm)
 
 	// category
 	r.GET("/categories", handler.GetCategories)
 	r.GET("/categories/:id", handler.GetCategory)
+	r.GET("/category-slugs/:slug", handler.GetCategoryBySlug)
 
 	// post
 	r.GET("/posts", handler.GetPosts)
 	r.GET("/posts/:id", handler.GetPost)
+	r.GET("/post-slugs/:slug", handler.GetPostBySlug)
 	r.GET("/categories/:id/posts", handler.GetCategoryPosts)
+
+	// tag
+	r.GET("/tags", handler.GetTags)
+	r.GET("/tags/:tag/posts", handler.GetTagPosts)
+
+	// search
+	r.GET("/search", handler.GetSearch)
+
+	// author
+	r.GET("/users/:id", handler.GetAuthor)
+	r.GET("/users/:id/posts", handler.GetAuthorPosts)
 }
 
 // registerAdminRoute registers admin api route
 func registerAdminRoute(r *gin.RouterGroup) {
-	// admin category
-	r.GET("/categories", handler.GetAdminCategories)
-	r.GET("/categories/:id", handler.GetAdminCategory)
-	r.POST("/categories", handler.PostCategory)
-	r.PUT("/categories/:id", handler.UpdateCategory)
-	r.PATCH("/categories/:id", handler.UpdateCategory)
-	r.DELETE("/categories/:id", handler.DeleteCategory)
-
-	// admin post
-	r.GET("/posts", handler.GetAdminPosts)
-	r.GET("/posts/:id", handler.GetAdminPost)
-	r.GET("/categories/:id/posts", handler.GetAdminCategoryPosts)
-	r.POST("/categories/:id/posts", handler.PostCategoryPost)
-	r.POST("/posts", handler.PostPost)
-	r.PUT("/posts/:id", handler.UpdatePost)
-	r.PATCH("/posts/:id", handler.UpdatePost)
-	r.DELETE("/posts/:id", handler.DeletePost)
+	r.POST("/logout", handler.PostLogout)
 
 	// admin user
+	r.GET("/users",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.GetUsers,
+	)
+	r.POST("/users",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.PostUser,
+	)
+	r.DELETE("/users/:id",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.DeleteUser,
+	)
 	r.PUT("/users/:id", handler.UpdateUser)
 	r.PATCH("/users/:id", handler.UpdateUser)
 	r.PUT("/users/:id/password", handler.UpdateUserPassword)
+	r.POST("/users/:id/totp", handler.PostUserTOTP)
+	r.POST("/users/:id/totp/verify", handler.PostUserTOTPVerify)
+	r.DELETE("/users/:id/totp", handler.DeleteUserTOTP)
+	r.GET("/users/:id/sessions", handler.GetUserSessions)
+	r.DELETE("/users/:id/sessions/:sid", handler.DeleteUserSession)
+
+	// audit log
+	r.GET("/audit",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.GetAuditLog,
+	)
+
+	// admin login lockout
+	r.GET("/lockouts",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.GetLockouts,
+	)
+	r.DELETE("/lockouts/:id",
+		handler.PermissionMiddleware(handler.PermUserManage),
+		handler.DeleteLockout,
+	)
+
+	// admin personal access token
+	r.GET("/tokens", handler.GetAccessTokens)
+	r.POST("/tokens", handler.PostAccessToken)
+	r.DELETE("/tokens/:id", handler.DeleteAccessToken)
+}
+
+// registerAdminTokenRoute registers admin api route which accepts both
+// jwt token and personal access token with the required scope
+func registerAdminTokenRoute(r *gin.RouterGroup) {
+	// admin category
+	r.GET("/categories",
+		handler.ScopeMiddleware(handler.ScopeCategoryRead),
+		handler.GetAdminCategories,
+	)
+	r.GET("/categories/:id",
+		handler.ScopeMiddleware(handler.ScopeCategoryRead),
+		handler.GetAdminCategory,
+	)
+	r.POST("/categories",
+		handler.ScopeMiddleware(handler.ScopeCategoryWrite),
+		handler.PermissionMiddleware(handler.PermCategoryManage),
+		handler.PostCategory,
+	)
+	r.PUT("/categories/:id",
+		handler.ScopeMiddleware(handler.ScopeCategoryWrite),
+		handler.PermissionMiddleware(handler.PermCategoryManage),
+		handler.UpdateCategory,
+	)
+	r.PATCH("/categories/:id",
+		handler.ScopeMiddleware(handler.ScopeCategoryWrite),
+		handler.PermissionMiddleware(handler.PermCategoryManage),
+		handler.UpdateCategory,
+	)
+	r.DELETE("/categories/:id",
+		handler.ScopeMiddleware(handler.ScopeCategoryWrite),
+		handler.PermissionMiddleware(handler.PermCategoryManage),
+		handler.DeleteCategory,
+	)
+
+	// admin post
+	r.GET("/posts",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetAdminPosts,
+	)
+	r.GET("/posts/:id",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetAdminPost,
+	)
+	r.GET("/categories/:id/posts",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetAdminCategoryPosts,
+	)
+	r.GET("/search",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetAdminSearch,
+	)
+	r.POST("/categories/:id/posts",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PermissionMiddleware(handler.PermPostCreate),
+		handler.PostCategoryPost,
+	)
+	r.POST("/posts",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PermissionMiddleware(handler.PermPostCreate),
+		handler.PostPost,
+	)
+	r.PUT("/posts/:id",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.UpdatePost,
+	)
+	r.PATCH("/posts/:id",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.UpdatePost,
+	)
+	r.DELETE("/posts/:id",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.DeletePost,
+	)
+	r.GET("/posts/:id/revisions",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetPostRevisions,
+	)
+	r.GET("/posts/:id/revisions/diff",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetPostRevisionDiff,
+	)
+	r.POST("/posts/:id/revisions/:rev/restore",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PostPostRevisionRestore,
+	)
+
+	// admin tag
+	r.GET("/tags",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetAdminTags,
+	)
+	r.PUT("/tags/:tag",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PermissionMiddleware(handler.PermPostEditOthers),
+		handler.UpdateTag,
+	)
+	r.POST("/tags/merge",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PermissionMiddleware(handler.PermPostEditOthers),
+		handler.PostTagMerge,
+	)
+
+	// admin trash
+	r.GET("/trash",
+		handler.ScopeMiddleware(handler.ScopePostRead),
+		handler.GetTrash,
+	)
+	r.POST("/trash/posts/:id/restore",
+		handler.ScopeMiddleware(handler.ScopePostWrite),
+		handler.PostTrashPostRestore,
+	)
+	r.POST("/trash/categories/:id/restore",
+		handler.ScopeMiddleware(handler.ScopeCategoryWrite),
+		handler.PermissionMiddleware(handler.PermCategoryManage),
+		handler.PostTrashCategoryRestore,
+	)
 }
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"container/list"
+	"sync"
+)
+
+// maxCacheEntries the amount of rendered posts kept in cache,
+// the least recently used one is evicted first
+const maxCacheEntries = 1000
+
+// cacheEntry the rendered content of a post
+type cacheEntry struct {
+	id      string
+	format  string
+	content string
+	result  Rendered
+}
+
+var (
+	mutex    sync.Mutex
+	recent   = list.New() // the most recently used entry first
+	cacheMap = make(map[string]*list.Element)
+)
+
+// Cached returns the rendered content of the post with the id, rendering
+// it only if it isn't in cache, or the format or content changed
+func Cached(id string, format string, content string) (Rendered, error) {
+	mutex.Lock()
+	if element, ok := cacheMap[id]; ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.format == format && entry.content == content {
+			recent.MoveToFront(element)
+			mutex.Unlock()
+			return entry.result, nil
+		}
+	}
+	mutex.Unlock()
+
+	rendered, err := Render(format, content)
+	if err != nil {
+		return rendered, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if element, ok := cacheMap[id]; ok {
+		recent.Remove(element)
+	}
+	cacheMap[id] = recent.PushFront(&cacheEntry{
+		id:      id,
+		format:  format,
+		content: content,
+		result:  rendered,
+	})
+
+	for recent.Len() > maxCacheEntries {
+		oldest := recent.Back()
+		recent.Remove(oldest)
+		delete(cacheMap, oldest.Value.(*cacheEntry).id)
+	}
+
+	return rendered, nil
+}
+
+// Invalidate removes the rendered posts from cache
+func Invalidate(ids ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, id := range ids {
+		if element, ok := cacheMap[id]; ok {
+			recent.Remove(element)
+			delete(cacheMap, id)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// moreMarker the marker in content that ends the excerpt
+const moreMarker = "<!--more-->"
+
+// excerptLength the maximum characters of an excerpt
+// derived from content without the marker
+const excerptLength = 200
+
+// stripPolicy removes all html tags
+var stripPolicy = bluemonday.StrictPolicy()
+
+// blockEnd the end of a block element or a line break
+var blockEnd = regexp.MustCompile(`(?i)</(p|div|li|h[1-6]|td|th|tr|pre|blockquote)>|<br\s*/?>`)
+
+// text returns the plain text of the html, whitespace
+// is collapsed into single spaces
+func text(rendered string) string {
+	// keep the text of adjacent blocks apart
+	rendered = blockEnd.ReplaceAllString(rendered, "$0 ")
+
+	return strings.Join(strings.Fields(html.UnescapeString(stripPolicy.Sanitize(rendered))), " ")
+}
+
+// truncate returns the text truncated to at most length characters,
+// a word that isn't CJK isn't cut in half unless it's too long
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+
+	end := length
+	if !isBreak(runes[end-1]) && !isBreak(runes[end]) {
+		// move back to the start of the word
+		i := end
+		for i > length/2 && !isBreak(runes[i-1]) {
+			i--
+		}
+		if i > length/2 {
+			end = i
+		}
+	}
+
+	return strings.TrimSpace(string(runes[:end])) + "…"
+}
+
+// isBreak reports whether the text can be cut before or after the rune,
+// CJK characters aren't separated by spaces so they can be cut anywhere
+func isBreak(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) ||
+		unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,145 @@
+// Package render renders the content of posts to sanitized html
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// the formats of post content
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatPlain    = "plain"
+)
+
+// ValidFormat reports whether the content format is supported,
+// empty format is markdown
+func ValidFormat(format string) bool {
+	switch format {
+	case "", FormatMarkdown, FormatHTML, FormatPlain:
+		return true
+	}
+
+	return false
+}
+
+// markdown the CommonMark renderer with GitHub Flavored Markdown
+// extensions and footnotes, raw html is kept and sanitized later
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		extension.Footnote,
+	),
+	goldmark.WithRendererOptions(
+		goldmarkhtml.WithUnsafe(),
+	),
+)
+
+// policy the sanitizer of user generated html, which also allows
+// the task list checkboxes, footnote links and code languages
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref)?:[0-9]+$`)).OnElements("li", "sup")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote(s|-ref|-backref)$`)).OnElements("div", "a")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(endnotes|noteref|backlink)$`)).OnElements("div", "a")
+
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	return p
+}()
+
+// plain renders plain text, paragraphs are separated by blank
+// lines and line breaks are kept
+func plain(content string) string {
+	var b strings.Builder
+
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if paragraph == "" {
+			continue
+		}
+
+		b.WriteString("<p>")
+		b.WriteString(strings.Replace(html.EscapeString(paragraph), "\n", "<br>\n", -1))
+		b.WriteString("</p>\n")
+	}
+
+	return b.String()
+}
+
+// Rendered the rendered content of a post
+type Rendered struct {
+	HTML    string // sanitized html of the whole content
+	Excerpt string // plain text excerpt of the content
+}
+
+// renderHTML renders the content in the format to sanitized html
+func renderHTML(format string, content string) (string, error) {
+	var rendered string
+	switch format {
+	case FormatPlain:
+		return plain(content), nil
+
+	case FormatHTML:
+		rendered = content
+
+	default:
+		var buf bytes.Buffer
+		err := markdown.Convert([]byte(content), &buf)
+		if err != nil {
+			return "", err
+		}
+		rendered = buf.String()
+	}
+
+	return policy.Sanitize(rendered), nil
+}
+
+// Render renders the content in the format to sanitized html
+// and derives the excerpt of the content
+func Render(format string, content string) (Rendered, error) {
+	var rendered Rendered
+	var err error
+
+	rendered.HTML, err = renderHTML(format, content)
+	if err != nil {
+		return rendered, err
+	}
+
+	if i := strings.Index(content, moreMarker); i >= 0 {
+		// the part before the marker is the excerpt
+		before, err := renderHTML(format, content[:i])
+		if err != nil {
+			return rendered, err
+		}
+		rendered.Excerpt = text(before)
+	} else {
+		rendered.Excerpt = truncate(text(rendered.HTML), excerptLength)
+	}
+
+	return rendered, nil
+}
+
+// Text renders the content in the format to plain text,
+// which is what readers see without the markup
+func Text(format string, content string) (string, error) {
+	rendered, err := renderHTML(format, content)
+	if err != nil {
+		return "", err
+	}
+
+	return text(rendered), nil
+}
@@ -0,0 +1,253 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		length int
+		want   string
+	}{
+		{"short", "hello world", 20, "hello world"},
+		{"exact", "hello world", 11, "hello world"},
+		{"at space", "hello world", 6, "hello…"},
+		{"inside word", "hello world", 8, "hello…"},
+		{"long word", "abcdefghij", 4, "abcd…"},
+		{"cjk", "中文中文中文", 5, "中文中文中…"},
+		{"cjk before word", "中文 hello", 4, "中文…"},
+		{"after punctuation", "hi, there", 3, "hi,…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.text, tt.length); got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.length, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderExcerpt(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		excerpt string
+	}{
+		{
+			"markdown",
+			FormatMarkdown,
+			"# Title\n\nHello **world** & <script>alert(1)</script>friends.",
+			"Title Hello world & friends.",
+		},
+		{
+			"default format",
+			"",
+			"Hello *world*",
+			"Hello world",
+		},
+		{
+			"more marker",
+			FormatMarkdown,
+			"First paragraph.\n\n<!--more-->\n\nSecond paragraph.",
+			"First paragraph.",
+		},
+		{
+			"more marker in html",
+			FormatHTML,
+			"<p>Hello</p><p>World</p><!--more--><p>Rest</p>",
+			"Hello World",
+		},
+		{
+			"more marker after long text",
+			FormatPlain,
+			strings.Repeat("word ", 60) + "<!--more-->rest",
+			strings.TrimSpace(strings.Repeat("word ", 60)),
+		},
+		{
+			"plain",
+			FormatPlain,
+			"Line one\nline two\n\n<b>not bold</b>",
+			"Line one line two <b>not bold</b>",
+		},
+		{
+			"long words",
+			FormatMarkdown,
+			strings.Repeat("word ", 50),
+			strings.TrimSpace(strings.Repeat("word ", 40)) + "…",
+		},
+		{
+			"long cjk",
+			FormatMarkdown,
+			strings.Repeat("中文", 120),
+			strings.Repeat("中文", 100) + "…",
+		},
+		{
+			"task list",
+			FormatMarkdown,
+			"- [x] done\n- [ ] todo\n",
+			"done todo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.format, tt.content)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if rendered.Excerpt != tt.excerpt {
+				t.Errorf("Render() excerpt = %q, want %q", rendered.Excerpt, tt.excerpt)
+			}
+			if strings.Contains(rendered.HTML, moreMarker) || strings.Contains(rendered.HTML, "<script") {
+				t.Errorf("Render() html = %q, which isn't sanitized", rendered.HTML)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+		want    string
+	}{
+		{FormatMarkdown, "# Go\n\n[Link](https://golang.org) and `code`", "Go Link and code"},
+		{FormatHTML, "<h2>Go</h2><p>a &lt; b</p>", "Go a < b"},
+		{FormatPlain, "<b>Go</b>\nnext", "<b>Go</b> next"},
+	}
+
+	for _, tt := range tests {
+		got, err := Text(tt.format, tt.content)
+		if err != nil {
+			t.Fatalf("Text() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Text(%q, %q) = %q, want %q", tt.format, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string // the html must contain them
+		unsafe  []string // the html mustn't contain them
+	}{
+		{
+			"table",
+			"| a | b |\n|---|---|\n| 1 | 2 |\n",
+			[]string{"<table>", "<th>a</th>", "<td>2</td>"},
+			nil,
+		},
+		{
+			"footnote",
+			"text[^1]\n\n[^1]: note\n",
+			[]string{
+				`<sup id="fnref:1"><a href="#fn:1" class="footnote-ref" role="doc-noteref"`,
+				`<div class="footnotes" role="doc-endnotes">`,
+				`<li id="fn:1">`,
+				`<a href="#fnref:1" class="footnote-backref" role="doc-backlink"`,
+			},
+			nil,
+		},
+		{
+			"task list",
+			"- [x] done\n- [ ] todo\n",
+			[]string{
+				`<input checked="" disabled="" type="checkbox"> done`,
+				`<input disabled="" type="checkbox"> todo`,
+			},
+			nil,
+		},
+		{
+			"strikethrough and autolink",
+			"~~old~~ https://example.com",
+			[]string{"<del>old</del>", `<a href="https://example.com" rel="nofollow">`},
+			nil,
+		},
+		{
+			"unsafe html",
+			`<input type="text" onclick="x()"><a href="javascript:alert(1)" class="evil">x</a><script>alert(1)</script>`,
+			nil,
+			[]string{"<input", "onclick", "javascript:", "evil", "<script"},
+		},
+		{
+			"code language",
+			"```go\nfmt.Println()\n```\n\n<code class=\"language-go evil\">x</code>",
+			[]string{`<code class="language-go">fmt.Println()`},
+			[]string{"evil"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(FormatMarkdown, tt.content)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rendered.HTML, want) {
+					t.Errorf("Render() html = %q, want it to contain %q", rendered.HTML, want)
+				}
+			}
+			for _, unsafe := range tt.unsafe {
+				if strings.Contains(rendered.HTML, unsafe) {
+					t.Errorf("Render() html = %q, which contains %q", rendered.HTML, unsafe)
+				}
+			}
+		})
+	}
+}
+
+func TestCached(t *testing.T) {
+	Invalidate("cached")
+
+	rendered, err := Cached("cached", FormatMarkdown, "# One")
+	if err != nil {
+		t.Fatalf("Cached() error = %v", err)
+	}
+	if !strings.Contains(rendered.HTML, "One") {
+		t.Errorf("Cached() html = %q, want the first content", rendered.HTML)
+	}
+
+	// the content changed
+	rendered, err = Cached("cached", FormatMarkdown, "# Two")
+	if err != nil {
+		t.Fatalf("Cached() error = %v", err)
+	}
+	if !strings.Contains(rendered.HTML, "Two") {
+		t.Errorf("Cached() html = %q after content changed, want the new content", rendered.HTML)
+	}
+
+	// the format changed
+	rendered, err = Cached("cached", FormatPlain, "# Two")
+	if err != nil {
+		t.Fatalf("Cached() error = %v", err)
+	}
+	if !strings.Contains(rendered.HTML, "<p># Two</p>") {
+		t.Errorf("Cached() html = %q after format changed, want plain text", rendered.HTML)
+	}
+
+	// the cached result is returned for the same content,
+	// the entry is replaced to tell it from a new rendering
+	mutex.Lock()
+	cacheMap["cached"].Value.(*cacheEntry).result.HTML = "cached"
+	mutex.Unlock()
+
+	rendered, _ = Cached("cached", FormatPlain, "# Two")
+	if rendered.HTML != "cached" {
+		t.Errorf("Cached() html = %q for the same content, want the cached one", rendered.HTML)
+	}
+
+	Invalidate("cached")
+	rendered, _ = Cached("cached", FormatPlain, "# Two")
+	if rendered.HTML == "cached" {
+		t.Errorf("Cached() returns the cached html after Invalidate()")
+	}
+}
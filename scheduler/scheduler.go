@@ -0,0 +1,85 @@
+// Package scheduler runs the background jobs of the blog
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jaaaaason/hmblog/configer"
+	"github.com/jaaaaason/hmblog/database"
+	"github.com/jaaaaason/hmblog/logger"
+)
+
+// publishInterval how often the scheduled posts are checked
+const publishInterval = time.Minute
+
+// purgeInterval how often the trash is purged
+const purgeInterval = time.Hour
+
+// defaultTrashRetentionDays the days deleted posts and categories
+// are kept in trash if it's not given in config
+const defaultTrashRetentionDays = 30
+
+// publishDuePosts publishes the scheduled posts whose time has come
+func publishDuePosts() {
+	count, err := database.PublishDuePosts(time.Now())
+	if err != nil {
+		logger.Error("failed to publish scheduled posts: " + err.Error())
+		return
+	}
+
+	if count > 0 {
+		logger.Info(fmt.Sprintf("published %d scheduled posts", count))
+	}
+}
+
+// purgeTrash removes the posts and categories which have been
+// in trash longer than the retention
+func purgeTrash() {
+	days := configer.Config.TrashRetentionDays
+	if days == 0 {
+		days = defaultTrashRetentionDays
+	}
+	if days < 0 {
+		// keep the trash forever
+		return
+	}
+	before := time.Now().AddDate(0, 0, -days)
+
+	count, err := database.PurgePosts(before)
+	if err != nil {
+		logger.Error("failed to purge posts from trash: " + err.Error())
+	} else if count > 0 {
+		logger.Info(fmt.Sprintf("purged %d posts from trash", count))
+	}
+
+	count, err = database.PurgeCategories(before)
+	if err != nil {
+		logger.Error("failed to purge categories from trash: " + err.Error())
+	} else if count > 0 {
+		logger.Info(fmt.Sprintf("purged %d categories from trash", count))
+	}
+}
+
+// Start starts the scheduler in background, the posts due while
+// the server was down are published immediately, and the trash
+// out of retention is purged
+func Start() {
+	go func() {
+		publishDuePosts()
+
+		ticker := time.NewTicker(publishInterval)
+		for range ticker.C {
+			publishDuePosts()
+		}
+	}()
+
+	go func() {
+		purgeTrash()
+
+		ticker := time.NewTicker(purgeInterval)
+		for range ticker.C {
+			purgeTrash()
+		}
+	}()
+}
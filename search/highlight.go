@@ -0,0 +1,97 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+const (
+	snippetLength = 120 // runes in a content snippet
+	snippetBefore = 20  // runes before the first match in a snippet
+)
+
+// matches marks the runes of the text that are part of the terms
+func matches(text []rune, terms []string) []bool {
+	wanted := make(map[string]bool)
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	marked := make([]bool, len(text))
+	for _, t := range tokenize(text, true) {
+		if wanted[t.term] {
+			for i := t.start; i < t.end; i++ {
+				marked[i] = true
+			}
+		}
+	}
+
+	return marked
+}
+
+// highlight escapes the text as html and wraps the marked runes
+// between start and end with "<em>" elements
+func highlight(text []rune, marked []bool, start int, end int) string {
+	var b strings.Builder
+
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+
+		if marked[i] {
+			b.WriteString("<em>")
+			b.WriteString(html.EscapeString(string(text[i:j])))
+			b.WriteString("</em>")
+		} else {
+			b.WriteString(html.EscapeString(string(text[i:j])))
+		}
+		i = j
+	}
+
+	return b.String()
+}
+
+// highlightTitle returns the whole title with the terms highlighted
+func highlightTitle(title string, terms []string) string {
+	text := []rune(title)
+
+	return highlight(text, matches(text, terms), 0, len(text))
+}
+
+// snippet returns a part of the content around the first match with
+// the terms highlighted, the beginning of the content if nothing matches
+func snippet(content string, terms []string) string {
+	text := []rune(content)
+	marked := matches(text, terms)
+
+	start := 0
+	for i := range marked {
+		if marked[i] {
+			start = i - snippetBefore
+			break
+		}
+	}
+	if start+snippetLength > len(text) {
+		start = len(text) - snippetLength
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + snippetLength
+	if end > len(text) {
+		end = len(text)
+	}
+
+	s := highlight(text, marked, start, end)
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+
+	return s
+}
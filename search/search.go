@@ -0,0 +1,226 @@
+// Package search is an in-process full-text index of the blog posts,
+// CJK text is segmented into bigrams so that Chinese posts can be
+// searched without a dictionary, results are ranked with BM25
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// the indexed fields of a document
+const (
+	fieldTitle = iota
+	fieldTags
+	fieldContent
+	fieldCount
+)
+
+// fieldBoost the weight of a match in each field
+var fieldBoost = [fieldCount]float64{
+	fieldTitle:   3,
+	fieldTags:    2,
+	fieldContent: 1,
+}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document the searchable fields of a post
+type Document struct {
+	ID        string
+	Title     string
+	Content   string // plain text of the rendered content
+	Tags      []string
+	IsPublish bool
+	UserID    string
+}
+
+// Result a document that matches the query
+type Result struct {
+	ID      string
+	Score   float64
+	Title   string // title with the matches highlighted
+	Snippet string // part of content with the matches highlighted
+}
+
+// entry an indexed document
+type entry struct {
+	doc     Document
+	lengths [fieldCount]int
+	freqs   map[string]*[fieldCount]int
+}
+
+var (
+	mutex        sync.RWMutex
+	entries      = make(map[string]*entry)
+	postings     = make(map[string]map[string]bool) // term to ids
+	totalLengths [fieldCount]int
+)
+
+// Index adds the document to the index, replacing the indexed
+// document with the same id
+func Index(doc Document) {
+	e := &entry{
+		doc:   doc,
+		freqs: make(map[string]*[fieldCount]int),
+	}
+
+	texts := [fieldCount]string{
+		fieldTitle:   doc.Title,
+		fieldTags:    strings.Join(doc.Tags, " "),
+		fieldContent: doc.Content,
+	}
+	for field, text := range texts {
+		tokens := tokenize([]rune(text), true)
+		e.lengths[field] = len(tokens)
+
+		for _, t := range tokens {
+			if e.freqs[t.term] == nil {
+				e.freqs[t.term] = new([fieldCount]int)
+			}
+			e.freqs[t.term][field]++
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	remove(doc.ID)
+
+	entries[doc.ID] = e
+	for field := range e.lengths {
+		totalLengths[field] += e.lengths[field]
+	}
+	for term := range e.freqs {
+		if postings[term] == nil {
+			postings[term] = make(map[string]bool)
+		}
+		postings[term][doc.ID] = true
+	}
+}
+
+// Remove removes the documents from the index
+func Remove(ids ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, id := range ids {
+		remove(id)
+	}
+}
+
+// remove removes the document, the caller must hold the write lock
+func remove(id string) {
+	e, ok := entries[id]
+	if !ok {
+		return
+	}
+
+	delete(entries, id)
+	for field := range e.lengths {
+		totalLengths[field] -= e.lengths[field]
+	}
+	for term := range e.freqs {
+		delete(postings[term], id)
+		if len(postings[term]) == 0 {
+			delete(postings, term)
+		}
+	}
+}
+
+// Search returns the documents that contain all terms of the query and
+// are accepted by match, ranked by relevance, the total amount and the
+// results skipping offset and at most limit, which is ignored if zero
+func Search(query string, match func(Document) bool, offset int, limit int) ([]Result, int) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return nil, 0
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	// start with the rarest term to check the fewest documents
+	sort.Slice(terms, func(i, j int) bool {
+		return len(postings[terms[i]]) < len(postings[terms[j]])
+	})
+
+	var averageLengths [fieldCount]float64
+	for field := range totalLengths {
+		if len(entries) > 0 {
+			averageLengths[field] = float64(totalLengths[field]) / float64(len(entries))
+		}
+	}
+
+	var results []Result
+	for id := range postings[terms[0]] {
+		e := entries[id]
+		if !match(e.doc) {
+			continue
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			freqs, ok := e.freqs[term]
+			if !ok {
+				score = 0
+				break
+			}
+
+			n := float64(len(postings[term]))
+			idf := math.Log(1 + (float64(len(entries))-n+0.5)/(n+0.5))
+			for field, freq := range freqs {
+				if freq == 0 {
+					continue
+				}
+
+				norm := 1 - bm25B
+				if averageLengths[field] > 0 {
+					norm += bm25B * float64(e.lengths[field]) / averageLengths[field]
+				}
+				tf := float64(freq)
+				score += fieldBoost[field] * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+			}
+		}
+		if score == 0 {
+			continue
+		}
+
+		results = append(results, Result{
+			ID:    id,
+			Score: score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		// the later document first
+		return results[i].ID > results[j].ID
+	})
+
+	total := len(results)
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+
+	// only highlight the returned results
+	for i := range results {
+		doc := entries[results[i].ID].doc
+		results[i].Title = highlightTitle(doc.Title, terms)
+		results[i].Snippet = snippet(doc.Content, terms)
+	}
+
+	return results, total
+}
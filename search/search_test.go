@@ -0,0 +1,178 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		unigram bool
+		tokens  []token
+	}{
+		{
+			"words",
+			"Hello, World 42",
+			false,
+			[]token{{"hello", 0, 5}, {"world", 7, 12}, {"42", 13, 15}},
+		},
+		{
+			"cjk bigrams",
+			"中文搜索",
+			false,
+			[]token{{"中文", 0, 2}, {"文搜", 1, 3}, {"搜索", 2, 4}},
+		},
+		{
+			"cjk unigrams",
+			"中文搜",
+			true,
+			[]token{{"中", 0, 1}, {"中文", 0, 2}, {"文", 1, 2}, {"文搜", 1, 3}, {"搜", 2, 3}},
+		},
+		{
+			"single cjk character",
+			"中",
+			false,
+			[]token{{"中", 0, 1}},
+		},
+		{
+			"mixed",
+			"Go语言，入门",
+			false,
+			[]token{{"go", 0, 2}, {"语言", 2, 4}, {"入门", 5, 7}},
+		},
+		{
+			"kana and hangul",
+			"ひらがな 한국",
+			false,
+			[]token{{"ひら", 0, 2}, {"らが", 1, 3}, {"がな", 2, 4}, {"한국", 5, 7}},
+		},
+		{
+			"accented word",
+			"Crème brûlée",
+			false,
+			[]token{{"crème", 0, 5}, {"brûlée", 6, 12}},
+		},
+		{
+			"no terms",
+			"!!! ...",
+			true,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := tokenize([]rune(tt.text), tt.unigram)
+			if !reflect.DeepEqual(tokens, tt.tokens) {
+				t.Errorf("tokenize(%q, %v) = %v, want %v", tt.text, tt.unigram, tokens, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []string
+	}{
+		{"go Go GO", []string{"go"}},
+		{"Go 语言", []string{"go", "语言"}},
+		{"搜索 搜索引擎", []string{"搜索", "索引", "引擎"}},
+		{"中", []string{"中"}},
+		{"  ", nil},
+	}
+
+	for _, tt := range tests {
+		if terms := queryTerms(tt.query); !reflect.DeepEqual(terms, tt.terms) {
+			t.Errorf("queryTerms(%q) = %q, want %q", tt.query, terms, tt.terms)
+		}
+	}
+}
+
+// indexDocuments replaces the index with the documents
+func indexDocuments(docs []Document) {
+	var ids []string
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	Remove(ids...)
+
+	for _, doc := range docs {
+		Index(doc)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	indexDocuments([]Document{
+		{ID: "1", Title: "Cooking notes", Content: "A recipe that uses go as a verb.", Tags: []string{"cooking"}, IsPublish: true},
+		{ID: "2", Title: "Learning Go", Content: "Go is a programming language.", Tags: []string{"learning"}, IsPublish: true},
+		{ID: "3", Title: "Weekly notes", Content: "Nothing about code.", Tags: []string{"go"}, IsPublish: true},
+		{ID: "4", Title: "Go draft", Content: "Go go go.", Tags: []string{"draft"}, IsPublish: false},
+		{ID: "5", Title: "中文搜索", Content: "在博客中搜索中文博文。", Tags: []string{"中文"}, IsPublish: true},
+		{ID: "6", Title: "Search engine", Content: "搜一下，索引", Tags: []string{"search"}, IsPublish: true},
+	})
+	published := func(doc Document) bool {
+		return doc.IsPublish
+	}
+	all := func(Document) bool {
+		return true
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		match  func(Document) bool
+		offset int
+		limit  int
+		ids    []string
+		total  int
+	}{
+		{"title before tags before content", "go", published, 0, 0, []string{"2", "3", "1"}, 3},
+		{"drafts are matched", "go", all, 0, 0, []string{"4", "2", "3", "1"}, 4},
+		{"all terms required", "go programming", published, 0, 0, []string{"2"}, 1},
+		{"case insensitive", "GO", published, 0, 1, []string{"2"}, 3},
+		{"offset and limit", "go", published, 1, 1, []string{"3"}, 3},
+		{"offset past results", "go", published, 5, 1, []string{}, 3},
+		{"cjk bigram", "搜索", published, 0, 0, []string{"5"}, 1},
+		{"cjk phrase", "中文博文", published, 0, 0, []string{"5"}, 1},
+		{"cjk not adjacent", "一索", published, 0, 0, []string{}, 0},
+		{"no match", "rust", published, 0, 0, []string{}, 0},
+		{"no terms", "!!!", published, 0, 0, []string{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, total := Search(tt.query, tt.match, tt.offset, tt.limit)
+
+			ids := []string{}
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) || total != tt.total {
+				t.Errorf("Search(%q) = %v, %d, want %v, %d", tt.query, ids, total, tt.ids, tt.total)
+			}
+		})
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	indexDocuments([]Document{
+		{ID: "1", Title: "Learning <Go>", Content: "中文搜索 & Go", IsPublish: true},
+	})
+
+	results, _ := Search("go 搜索", func(Document) bool {
+		return true
+	}, 0, 0)
+	if len(results) != 1 {
+		t.Fatalf("Search() returns %d results, want 1", len(results))
+	}
+
+	if want := "Learning &lt;<em>Go</em>&gt;"; results[0].Title != want {
+		t.Errorf("Title = %q, want %q", results[0].Title, want)
+	}
+	if want := "中文<em>搜索</em> &amp; <em>Go</em>"; results[0].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", results[0].Snippet, want)
+	}
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"unicode"
+)
+
+// isCJK reports whether the rune is a Chinese, Japanese or Korean
+// character, which isn't separated by spaces into words
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isWordRune reports whether the rune is part of a non-CJK word
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isCJK(r)
+}
+
+// token a term and its position in the text
+type token struct {
+	term  string
+	start int // index of the first rune
+	end   int // index after the last rune
+}
+
+// tokenize splits the text into lower case terms, a non-CJK word is
+// a term, a run of CJK characters is segmented into overlapping
+// bigrams, each character of the run is also a term if unigram is true
+func tokenize(text []rune, unigram bool) []token {
+	var tokens []token
+
+	for i := 0; i < len(text); {
+		switch {
+		case isWordRune(text[i]):
+			start := i
+			for i < len(text) && isWordRune(text[i]) {
+				i++
+			}
+			tokens = append(tokens, token{
+				term:  lower(text[start:i]),
+				start: start,
+				end:   i,
+			})
+
+		case isCJK(text[i]):
+			start := i
+			for i < len(text) && isCJK(text[i]) {
+				i++
+			}
+
+			if i-start == 1 {
+				// a single character is a term itself
+				tokens = append(tokens, token{
+					term:  lower(text[start:i]),
+					start: start,
+					end:   i,
+				})
+				continue
+			}
+
+			for j := start; j < i; j++ {
+				if unigram {
+					tokens = append(tokens, token{
+						term:  lower(text[j : j+1]),
+						start: j,
+						end:   j + 1,
+					})
+				}
+				if j+1 < i {
+					tokens = append(tokens, token{
+						term:  lower(text[j : j+2]),
+						start: j,
+						end:   j + 2,
+					})
+				}
+			}
+
+		default:
+			i++
+		}
+	}
+
+	return tokens
+}
+
+// lower returns the lower case string of the runes
+func lower(runes []rune) string {
+	lowered := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+	}
+
+	return string(lowered)
+}
+
+// queryTerms returns the distinct terms of the query, a CJK run
+// longer than one character is matched by its bigrams only
+func queryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+
+	for _, t := range tokenize([]rune(query), false) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+
+	return terms
+}
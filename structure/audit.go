@@ -0,0 +1,57 @@
+package structure
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// the actions recorded in audit log
+const (
+	AuditCategoryCreate    = "category.create"
+	AuditCategoryUpdate    = "category.update"
+	AuditCategoryDelete    = "category.delete"
+	AuditCategoryUndelete  = "category.undelete"
+	AuditPostCreate        = "post.create"
+	AuditPostUpdate        = "post.update"
+	AuditPostDelete        = "post.delete"
+	AuditPostRestore       = "post.restore"
+	AuditPostUndelete      = "post.undelete"
+	AuditTagRename         = "tag.rename"
+	AuditTagMerge          = "tag.merge"
+	AuditUserCreate        = "user.create"
+	AuditUserUpdate        = "user.update"
+	AuditUserPassword      = "user.password"
+	AuditUserDelete        = "user.delete"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserInvitation    = "user.invitation_accept"
+	AuditUserOIDCLink      = "user.oidc_link"
+	AuditUserTOTPEnroll    = "user.totp_enroll"
+	AuditUserTOTPEnable    = "user.totp_enable"
+	AuditUserTOTPDisable   = "user.totp_disable"
+	AuditSessionDelete     = "session.delete"
+	AuditTokenCreate       = "token.create"
+	AuditTokenDelete       = "token.delete"
+	AuditLockoutDelete     = "lockout.delete"
+	AuditLogin             = "login"
+	AuditLoginFailure      = "login.failure"
+	AuditLogout            = "logout"
+)
+
+// AuditChange the values of a field before and after a mutation
+type AuditChange struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// AuditEntry the audit log entry struct, records who did what
+// to which target, the entries are never updated or removed
+type AuditEntry struct {
+	ID        *bson.ObjectId         `json:"id" bson:"_id,omitempty"`
+	ActorID   *bson.ObjectId         `json:"actor_id" bson:"actor_id,omitempty"`
+	IP        string                 `json:"ip" bson:"ip"`
+	Action    string                 `json:"action" bson:"action"`
+	TargetID  string                 `json:"target_id" bson:"target_id"`
+	Diff      map[string]AuditChange `json:"diff" bson:"diff,omitempty"`
+	CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+}
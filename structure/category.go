@@ -1,10 +1,23 @@
 package structure
 
-import "github.com/globalsign/mgo/bson"
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
 
 // Category the blog category struct
 type Category struct {
 	ID        *bson.ObjectId `json:"id" bson:"_id,omitempty"`
 	Name      string         `json:"name" bson:"name" binding:"required"`
+	Slug      string         `json:"slug" bson:"slug,omitempty"`
 	PostCount int            `json:"post_count" bson:"-"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// Trash the deleted posts and categories which can be restored
+// until they are purged
+type Trash struct {
+	Posts      []Post     `json:"posts"`
+	Categories []Category `json:"categories"`
 }
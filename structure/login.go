@@ -1,7 +1,74 @@
 package structure
 
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
 // Login used to bind POST request data for /admin/login
 type Login struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+// LoginChallenge the second step of login, created after the password
+// is verified for a user who has enabled two-factor authentication,
+// only the hash of token is stored
+type LoginChallenge struct {
+	ID        *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	TokenHash string         `json:"-" bson:"token_hash"`
+	UserID    *bson.ObjectId `json:"-" bson:"user_id"`
+	Attempts  int            `json:"-" bson:"attempts"`
+	CreatedAt time.Time      `json:"-" bson:"created_at"`
+	ExpiresAt time.Time      `json:"-" bson:"expires_at"`
+}
+
+// OIDCState the state of an OpenID Connect login, created when the
+// user is redirected to the provider and used once in the callback,
+// only the hash of state is stored
+type OIDCState struct {
+	ID           *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	StateHash    string         `json:"-" bson:"state_hash"`
+	Nonce        string         `json:"-" bson:"nonce"`
+	CodeVerifier string         `json:"-" bson:"code_verifier"`
+	CreatedAt    time.Time      `json:"-" bson:"created_at"`
+	ExpiresAt    time.Time      `json:"-" bson:"expires_at"`
+}
+
+// OIDCCallback used to bind POST request data for /admin/oidc/callback,
+// the code and state are given by the provider in the redirect url
+type OIDCCallback struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// TOTPLogin used to bind POST request data for /admin/login/totp,
+// the code is either a TOTP code or a recovery code
+type TOTPLogin struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// TOTPCode used to bind request data for verifying TOTP code
+type TOTPCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// the kinds of login failure counters
+const (
+	LoginFailureUsername = "username"
+	LoginFailureIP       = "ip"
+)
+
+// LoginFailure the failed login counter of a username or an ip address,
+// the counter is removed a while after the last failure
+type LoginFailure struct {
+	ID          *bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Kind        string         `json:"kind" bson:"kind"`
+	Value       string         `json:"value" bson:"value"`
+	Failures    int            `json:"failures" bson:"failures"`
+	LastFailure time.Time      `json:"last_failure" bson:"last_failure"`
+	LockedUntil *time.Time     `json:"locked_until" bson:"-"`
+	ExpiresAt   time.Time      `json:"-" bson:"expires_at"`
+}
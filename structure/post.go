@@ -10,14 +10,42 @@ import (
 type Post struct {
 	ID           *bson.ObjectId `json:"id" bson:"_id,omitempty"`
 	Title        string         `json:"title" bson:"title,omitempty" binding:"required"`
-	Content      string         `json:"content" bson:"content,omitempty" binding:"required"`
+	Slug         string         `json:"slug" bson:"slug,omitempty"`
+	Content      string         `json:"content,omitempty" bson:"content,omitempty" binding:"required"`
+	Format       string         `json:"format" bson:"format,omitempty"`
+	ContentHTML  string         `json:"content_html,omitempty" bson:"-"`
+	Excerpt      string         `json:"excerpt" bson:"excerpt,omitempty"`
 	IsPublish    *bool          `json:"is_publish" bson:"is_publish,omitempty" binding:"exists"`
+	PublishAt    *time.Time     `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+	Status       string         `json:"status" bson:"-"`
 	CategoryID   *bson.ObjectId `json:"-" bson:"category_id,omitempty"`
 	Category     *Category      `json:"category" bson:"-"`
 	CategoryName string         `json:"category_name,omitempty" bson:"-"`
 	Tags         []string       `json:"tags" bson:"tags"`
 	UserID       *bson.ObjectId `json:"-" bson:"user_id,omitempty"`
-	User         *User          `json:"user" bson:"-"`
+	User         *Author        `json:"user" bson:"-"`
 	CreatedAt    time.Time      `json:"created_at" bson:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at" bson:"updated_at"`
+	DeletedAt    *time.Time     `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// the states of a post
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+)
+
+// SearchResult the post that matches the search query
+type SearchResult struct {
+	Post
+	Score     float64         `json:"score"`
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+// SearchHighlight the html of the post's fields with
+// the matches wrapped by "<em>" elements
+type SearchHighlight struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
 }
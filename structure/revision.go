@@ -0,0 +1,30 @@
+package structure
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// PostRevision a previous version of a post, saved before
+// the post is updated, the number increases for each post
+type PostRevision struct {
+	ID         *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	PostID     *bson.ObjectId `json:"post_id" bson:"post_id"`
+	Number     int            `json:"number" bson:"number"`
+	Title      string         `json:"title" bson:"title"`
+	Content    string         `json:"content" bson:"content"`
+	Format     string         `json:"format" bson:"format,omitempty"`
+	Excerpt    string         `json:"excerpt,omitempty" bson:"excerpt,omitempty"`
+	Tags       []string       `json:"tags" bson:"tags"`
+	CategoryID *bson.ObjectId `json:"category_id,omitempty" bson:"category_id,omitempty"`
+	EditorID   *bson.ObjectId `json:"editor_id" bson:"editor_id,omitempty"`
+	CreatedAt  time.Time      `json:"created_at" bson:"created_at"`
+}
+
+// RevisionDiff the unified diff between two versions of a post
+type RevisionDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Diff string `json:"diff"`
+}
@@ -0,0 +1,17 @@
+package structure
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// SlugHistory a previous slug of a post or category, the
+// collection is "posts" or "categories"
+type SlugHistory struct {
+	ID         *bson.ObjectId `bson:"_id,omitempty"`
+	Collection string         `bson:"collection"`
+	Slug       string         `bson:"slug"`
+	TargetID   *bson.ObjectId `bson:"target_id"`
+	CreatedAt  time.Time      `bson:"created_at"`
+}
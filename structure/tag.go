@@ -0,0 +1,19 @@
+package structure
+
+// Tag the tag of posts with the amount of posts using it
+type Tag struct {
+	Name      string `json:"name" bson:"_id"`
+	PostCount int    `json:"post_count" bson:"post_count"`
+}
+
+// TagRename used to bind PUT request data for /admin/tags/:tag
+type TagRename struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// TagMerge used to bind POST request data for /admin/tags/merge,
+// the tags are replaced by the tag Into in all posts
+type TagMerge struct {
+	Tags []string `json:"tags" binding:"required"`
+	Into string   `json:"into" binding:"required"`
+}
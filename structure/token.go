@@ -0,0 +1,74 @@
+package structure
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// RefreshToken the refresh token struct, only the hash
+// of the token is stored, tokens rotated from the same
+// login share the same family id
+type RefreshToken struct {
+	ID        *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	TokenHash string         `json:"-" bson:"token_hash"`
+	UserID    *bson.ObjectId `json:"-" bson:"user_id"`
+	FamilyID  *bson.ObjectId `json:"-" bson:"family_id"`
+	Used      bool           `json:"-" bson:"used"`
+	Revoked   bool           `json:"-" bson:"revoked"`
+	CreatedAt time.Time      `json:"-" bson:"created_at"`
+	ExpiresAt time.Time      `json:"-" bson:"expires_at"`
+}
+
+// RevokedToken the revoked access token struct, either a single
+// token revoked by its jti, or all tokens of a user issued before
+// IssuedBefore, it can be removed once ExpiresAt passes since
+// the revoked tokens have expired by then
+type RevokedToken struct {
+	ID           *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	JTI          string         `json:"-" bson:"jti,omitempty"`
+	UserID       *bson.ObjectId `json:"-" bson:"user_id,omitempty"`
+	IssuedBefore time.Time      `json:"-" bson:"issued_before,omitempty"`
+	ExpiresAt    time.Time      `json:"-" bson:"expires_at"`
+}
+
+// Session the login session struct, a session is created on each login
+// and shares the id with the refresh token family, tokens of a removed
+// session are rejected
+type Session struct {
+	ID         *bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	UserID     *bson.ObjectId `json:"-" bson:"user_id,omitempty"`
+	IP         string         `json:"ip" bson:"ip,omitempty"`
+	UserAgent  string         `json:"user_agent" bson:"user_agent,omitempty"`
+	CreatedAt  time.Time      `json:"created_at" bson:"created_at,omitempty"`
+	LastSeenAt time.Time      `json:"last_seen_at" bson:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time      `json:"expires_at" bson:"expires_at,omitempty"`
+	Current    bool           `json:"current" bson:"-"`
+}
+
+// TokenRefresh used to bind POST request data for /admin/token/refresh
+type TokenRefresh struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// AccessToken the personal access token struct, used by scripts
+// to access the admin api with limited scopes, only the hash
+// of the token is stored
+type AccessToken struct {
+	ID         *bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Name       string         `json:"name" bson:"name"`
+	TokenHash  string         `json:"-" bson:"token_hash"`
+	UserID     *bson.ObjectId `json:"-" bson:"user_id"`
+	Scopes     []string       `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time      `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time     `json:"last_used_at" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time     `json:"expires_at" bson:"expires_at,omitempty"`
+}
+
+// NewAccessToken used to bind POST request data for /admin/tokens,
+// the token never expires if ExpiresIn, in seconds, isn't given
+type NewAccessToken struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required"`
+	ExpiresIn int      `json:"expires_in"`
+}
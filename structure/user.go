@@ -1,10 +1,151 @@
 package structure
 
-import "github.com/globalsign/mgo/bson"
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// the roles of blog user
+const (
+	RoleOwner       = "owner"
+	RoleEditor      = "editor"
+	RoleAuthor      = "author"
+	RoleContributor = "contributor"
+)
 
 // User the blog user struct
 type User struct {
 	ID           *bson.ObjectId `json:"id" bson:"_id,omitempty"`
 	Username     string         `json:"username" bson:"username,omitempty"`
+	Email        string         `json:"email" bson:"email,omitempty" binding:"omitempty,email"`
 	PasswordHash []byte         `json:"-" bson:"password_hash,omitempty"`
+	Role         string         `json:"role" bson:"role,omitempty"`
+	Disabled     *bool          `json:"disabled" bson:"disabled,omitempty"`
+
+	// public profile
+	DisplayName string            `json:"display_name" bson:"display_name,omitempty"`
+	Bio         string            `json:"bio" bson:"bio,omitempty"`
+	AvatarURL   string            `json:"avatar_url" bson:"avatar_url,omitempty"`
+	Website     string            `json:"website" bson:"website,omitempty"`
+	SocialLinks map[string]string `json:"social_links" bson:"social_links,omitempty"`
+
+	// the user must change the password before using the admin api
+	MustChangePassword *bool `json:"must_change_password" bson:"must_change_password,omitempty"`
+
+	// the time the last password reset link was sent to the user
+	PasswordResetSentAt *time.Time `json:"-" bson:"password_reset_sent_at,omitempty"`
+
+	// the identity of OpenID Connect provider linked to the user
+	OIDCIssuer  string `json:"-" bson:"oidc_issuer,omitempty"`
+	OIDCSubject string `json:"-" bson:"oidc_subject,omitempty"`
+
+	// two-factor authentication, the secret is pending
+	// until it is verified and TOTPEnabled is set
+	TOTPSecret    string   `json:"-" bson:"totp_secret,omitempty"`
+	TOTPEnabled   *bool    `json:"totp_enabled" bson:"totp_enabled,omitempty"`
+	TOTPLastStep  int64    `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"`
+}
+
+// Author the public projection of user, shown on
+// the author page and embedded in posts
+type Author struct {
+	ID          *bson.ObjectId    `json:"id"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"display_name"`
+	Bio         string            `json:"bio"`
+	AvatarURL   string            `json:"avatar_url"`
+	Website     string            `json:"website"`
+	SocialLinks map[string]string `json:"social_links"`
+	PostCount   *int              `json:"post_count,omitempty"`
+}
+
+// Author returns the public projection of the user
+func (user User) Author() *Author {
+	return &Author{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		Website:     user.Website,
+		SocialLinks: user.SocialLinks,
+	}
+}
+
+// IsDisabled reports whether the user account is disabled
+func (user User) IsDisabled() bool {
+	return user.Disabled != nil && *user.Disabled
+}
+
+// IsPasswordChangeRequired reports whether the user
+// must change the password before using the admin api
+func (user User) IsPasswordChangeRequired() bool {
+	return user.MustChangePassword != nil && *user.MustChangePassword
+}
+
+// IsTOTPEnabled reports whether the user has enabled
+// TOTP two-factor authentication
+func (user User) IsTOTPEnabled() bool {
+	return user.TOTPEnabled != nil && *user.TOTPEnabled
+}
+
+// NewUser used to bind POST request data for /admin/users,
+// an invitation is created if password isn't given
+type NewUser struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// Invitation the invitation struct, lets an invited user
+// set their own password, only the hash of token is stored
+type Invitation struct {
+	ID        *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	TokenHash string         `json:"-" bson:"token_hash"`
+	UserID    *bson.ObjectId `json:"-" bson:"user_id"`
+	CreatedAt time.Time      `json:"-" bson:"created_at"`
+	ExpiresAt time.Time      `json:"-" bson:"expires_at"`
+}
+
+// InvitationAccept used to bind POST request data
+// for /admin/invitations/accept
+type InvitationAccept struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// PasswordReset the password reset struct, lets a user who forgot
+// the password set a new one, only the hash of token is stored
+type PasswordReset struct {
+	ID        *bson.ObjectId `json:"-" bson:"_id,omitempty"`
+	TokenHash string         `json:"-" bson:"token_hash"`
+	UserID    *bson.ObjectId `json:"-" bson:"user_id"`
+	CreatedAt time.Time      `json:"-" bson:"created_at"`
+	ExpiresAt time.Time      `json:"-" bson:"expires_at"`
+}
+
+// PasswordResetRequest used to bind POST request
+// data for /admin/password-reset
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordResetConfirm used to bind POST request
+// data for /admin/password-reset/confirm
+type PasswordResetConfirm struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// IsValidRole reports whether the role is one of the blog user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleEditor, RoleAuthor, RoleContributor:
+		return true
+	}
+
+	return false
 }